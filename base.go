@@ -0,0 +1,59 @@
+package main
+
+func recordsByPK(records []record, pk column) map[string]record {
+	byPK := map[string]record{}
+	for _, rec := range records {
+		byPK[rec[pk.SQL]] = rec
+	}
+	return byPK
+}
+
+// inBase drops the updates whose pk isn't in base, counting them as missing.
+func inBase(updates []record, base map[string]record, pk column) (kept []record, missing int) {
+	kept = []record{}
+	for _, upd := range updates {
+		if _, ok := base[upd[pk.SQL]]; !ok {
+			missing++
+			continue
+		}
+		kept = append(kept, upd)
+	}
+	return kept, missing
+}
+
+// inverseRecords returns, for each update, a record setting the columns it
+// changes back to their values in base. Updates whose pk isn't in base can't
+// be inverted and are counted as missing. The matchCols of an update aren't
+// set by it, so its inverse carries their values to match the same rows.
+func inverseRecords(updates []record, base map[string]record, pk column, matchCols []column) (inverse []record, missing int) {
+	match := map[string]bool{}
+	for _, col := range matchCols {
+		match[col.SQL] = true
+	}
+	inverse = []record{}
+	for _, upd := range updates {
+		old, ok := base[upd[pk.SQL]]
+		if !ok {
+			missing++
+			continue
+		}
+		inv := record{pk.SQL: upd[pk.SQL]}
+		for col, v := range upd {
+			if oldVal, ok := old[col]; ok && col != pk.SQL && !match[col] && oldVal != v {
+				inv[col] = oldVal
+			}
+		}
+		if len(inv) > 1 {
+			for _, col := range matchCols {
+				inv[col.SQL] = upd[col.SQL]
+			}
+			for _, key := range metaKeys {
+				if v, ok := upd[key]; ok {
+					inv[key] = v
+				}
+			}
+			inverse = append(inverse, inv)
+		}
+	}
+	return inverse, missing
+}
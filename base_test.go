@@ -0,0 +1,26 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInverseRecordsMatchColumns(t *testing.T) {
+	pk := column{"id", "id"}
+	base := map[string]record{
+		"1": {"id": "1", "email": "a@x", "name": "A"},
+		"2": {"id": "2", "email": "b@x", "name": "B"},
+	}
+	updates := []record{
+		{"id": "1", "email": "a@x", "name": "new"},
+		{"id": "2", "email": "b@x", "name": "B"},
+		{"id": "3", "email": "c@x", "name": "C"},
+	}
+	inverse, missing := inverseRecords(updates, base, pk, []column{{"email", "email"}})
+	// the unchanged update needs no inverse, and the match column is
+	// carried so the inverse matches the same row
+	want := []record{{"id": "1", "email": "a@x", "name": "A"}}
+	if !reflect.DeepEqual(inverse, want) || missing != 1 {
+		t.Errorf("got %q, %v missing, want %q, 1 missing", inverse, missing, want)
+	}
+}
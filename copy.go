@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// bulkData renders records as csv rows of their columns, in sorted order,
+// for loading in bulk. Strings are always quoted, so that an empty string
+// stays distinct from a NULL, which is written as null.
+func bulkData(records []record, pk column, null string, opts queryOpts) (cols []string, data string, err error) {
+	cols = sqlColumns(records[0])
+	var b strings.Builder
+	for _, rec := range records {
+		row, err := opts.insertRow(rec, cols, pk)
+		if err != nil {
+			return cols, data, err
+		}
+		fields := []string{}
+		for i, val := range row {
+			if cols[i] == pk.SQL && opts.pkType == "uuid" {
+				// csv data is text the column's type parses, so the
+				// validated uuid goes without the ::uuid cast of statements
+				val = rec[pk.SQL]
+			}
+			field, err := bulkField(val, null)
+			if err != nil {
+				return cols, data, fmt.Errorf("column %q: %w", cols[i], err)
+			}
+			fields = append(fields, field)
+		}
+		b.WriteString(strings.Join(fields, ",") + "\n")
+	}
+	return cols, b.String(), nil
+}
+
+// bulkField renders a value as a csv field. Raw sql, like now() or DEFAULT,
+// has no csv form.
+func bulkField(val any, null string) (string, error) {
+	switch v := val.(type) {
+	case nil:
+		return null, nil
+	case string:
+		return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`, nil
+	case int64, float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("raw sql can't be written as csv data")
+	}
+}
+
+// copyQuery builds a postgres COPY of records from stdin as csv, with the
+// data rows inline and ended by \., for loading with psql. An empty field
+// is NULL.
+func copyQuery(records []record, table string, pk column, opts queryOpts) (stmt statement, err error) {
+	cols, data, err := bulkData(records, pk, "", opts)
+	if err != nil {
+		return stmt, err
+	}
+	idents := []string{}
+	for _, col := range cols {
+		idents = append(idents, ident(opts.flavor, col))
+	}
+	sql := fmt.Sprintf("COPY %s (%s) FROM STDIN WITH (FORMAT csv);\n%s\\.", table, strings.Join(idents, ", "), data)
+	stmt = statement{SQL: sql, Fragment: true}
+	stmt.from(records, pk)
+	return stmt, nil
+}
+
+// loadDataQuery builds a mysql LOAD DATA LOCAL INFILE of records from the
+// csv at path, returning the csv to write there. With fields optionally
+// enclosed in quotes, an unquoted NULL is NULL.
+func loadDataQuery(records []record, table, path string, pk column, opts queryOpts) (stmt statement, data string, err error) {
+	cols, data, err := bulkData(records, pk, "NULL", opts)
+	if err != nil {
+		return stmt, data, err
+	}
+	idents := []string{}
+	for _, col := range cols {
+		idents = append(idents, ident(opts.flavor, col))
+	}
+	file, err := literal(opts.flavor, path)
+	if err != nil {
+		return stmt, data, err
+	}
+	sql := fmt.Sprintf(`LOAD DATA LOCAL INFILE %s INTO TABLE %s FIELDS TERMINATED BY ',' OPTIONALLY ENCLOSED BY '"' ESCAPED BY '' LINES TERMINATED BY '\n' (%s)`, file, table, strings.Join(idents, ", "))
+	stmt = statement{SQL: sql}
+	stmt.from(records, pk)
+	return stmt, data, nil
+}
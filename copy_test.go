@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func TestCopyQueryUUID(t *testing.T) {
+	records := []record{{"id": "123e4567-e89b-12d3-a456-426614174000", "name": "a"}}
+	opts := queryOpts{flavor: sqlbuilder.PostgreSQL, pkType: "uuid"}
+	stmt, err := copyQuery(records, "t", column{"id", "id"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "COPY t (id, name) FROM STDIN WITH (FORMAT csv);\n\"123e4567-e89b-12d3-a456-426614174000\",\"a\"\n\\."
+	if got := stmt.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if _, err := copyQuery([]record{{"id": "nope", "name": "a"}}, "t", column{"id", "id"}, opts); err == nil {
+		t.Error("want an error for a pk that isn't a uuid")
+	}
+}
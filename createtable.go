@@ -0,0 +1,109 @@
+package main
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// sqlTypes names each inferred column type in each dialect. MySQL can't index
+// TEXT without a prefix length, so strings are VARCHAR there.
+var sqlTypes = map[sqlbuilder.Flavor]map[string]string{
+	sqlbuilder.MySQL: {
+		"int": "BIGINT", "float": "DOUBLE", "bool": "BOOLEAN",
+		"date": "DATE", "datetime": "DATETIME", "string": "VARCHAR(255)", "json": "JSON",
+	},
+	sqlbuilder.PostgreSQL: {
+		"int": "BIGINT", "float": "DOUBLE PRECISION", "bool": "BOOLEAN",
+		"date": "DATE", "datetime": "TIMESTAMP", "string": "TEXT", "json": "JSONB",
+	},
+	sqlbuilder.SQLite: {
+		"int": "INTEGER", "float": "REAL", "bool": "BOOLEAN",
+		"date": "TEXT", "datetime": "TEXT", "string": "TEXT", "json": "TEXT",
+	},
+}
+
+var datetimeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// valueType guesses the column type of a single non-empty value.
+func valueType(v string) string {
+	if _, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return "int"
+	}
+	if _, err := strconv.ParseFloat(v, 64); err == nil {
+		return "float"
+	}
+	switch v {
+	case "true", "false", "TRUE", "FALSE", "True", "False":
+		return "bool"
+	}
+	if _, err := time.Parse("2006-01-02", v); err == nil {
+		return "date"
+	}
+	for _, layout := range datetimeLayouts {
+		if _, err := time.Parse(layout, v); err == nil {
+			return "datetime"
+		}
+	}
+	return "string"
+}
+
+// widen returns the narrowest type holding values of both types a and b.
+func widen(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case a == "int" && b == "float", a == "float" && b == "int":
+		return "float"
+	case a == "date" && b == "datetime", a == "datetime" && b == "date":
+		return "datetime"
+	default:
+		return "string"
+	}
+}
+
+// inferType guesses the column type of col across all records, skipping
+// empty values, which are NULL. A column with no values is a string.
+func inferType(records []record, col string) string {
+	typ := ""
+	for _, rec := range records {
+		if v := rec[col]; v != "" && v != "now()" {
+			typ = widen(typ, valueType(v))
+		}
+		if typ == "string" {
+			break
+		}
+	}
+	if typ == "" {
+		return "string"
+	}
+	return typ
+}
+
+// createTableQuery builds a CREATE TABLE IF NOT EXISTS for the columns of
+// records, inferring the types not declared in opts.types.
+func createTableQuery(records []record, table string, pk column, opts queryOpts) (statement, error) {
+	cols := []string{}
+	if len(records) > 0 {
+		cols = sqlColumns(records[0])
+	}
+
+	ctb := opts.flavor.NewCreateTableBuilder()
+	ctb.CreateTable(table).IfNotExists()
+	for _, col := range cols {
+		typ, ok := opts.types[col]
+		switch {
+		case opts.jsonCols[col]:
+			typ = "json"
+		case !ok:
+			typ = inferType(records, col)
+		}
+		def := []string{sqlbuilder.Escape(ident(opts.flavor, col)), sqlTypes[opts.flavor][typ]}
+		if col == pk.SQL {
+			def = append(def, "PRIMARY KEY")
+		}
+		ctb.Define(def...)
+	}
+	return opts.statement(ctb.Build())
+}
@@ -0,0 +1,44 @@
+package main
+
+import "time"
+
+// dateLayout is a layout --auto-date recognizes and the ISO 8601 layout it
+// rewrites matches to.
+type dateLayout struct {
+	in, out string
+}
+
+const (
+	isoDate     = "2006-01-02"
+	isoDateTime = "2006-01-02T15:04:05"
+)
+
+// dateLayouts are tried in order, so the first that parses a value wins.
+// Every layout has separators, so bare numbers like ids or 20240131 never
+// match, and slashed dates are read month first, as US exports write them.
+var dateLayouts = []dateLayout{
+	{time.RFC3339, time.RFC3339},
+	{"2006-01-02 15:04:05Z07:00", time.RFC3339},
+	{"2006-01-02 15:04:05", isoDateTime},
+	{"2006-01-02 15:04", isoDateTime},
+	{"2006/01/02 15:04:05", isoDateTime},
+	{"1/2/2006 15:04:05", isoDateTime},
+	{"1/2/2006 15:04", isoDateTime},
+	{"2006/01/02", isoDate},
+	{"1/2/2006", isoDate},
+	{"2-Jan-2006", isoDate},
+	{"2 Jan 2006", isoDate},
+	{"Jan 2, 2006", isoDate},
+	{"January 2, 2006", isoDate},
+}
+
+// autoDate rewrites v in ISO 8601 if it matches one of dateLayouts, and
+// otherwise returns it unchanged.
+func autoDate(v string) string {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout.in, v); err == nil {
+			return t.Format(layout.out)
+		}
+	}
+	return v
+}
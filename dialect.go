@@ -0,0 +1,128 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+var dialects = map[string]sqlbuilder.Flavor{
+	"mysql":      sqlbuilder.MySQL,
+	"postgresql": sqlbuilder.PostgreSQL,
+	"sqlite":     sqlbuilder.SQLite,
+}
+
+func dialectFlavor(dialect string) (sqlbuilder.Flavor, error) {
+	flavor, ok := dialects[dialect]
+	if !ok {
+		return flavor, fmt.Errorf("unknown dialect %q; expected mysql, postgresql or sqlite", dialect)
+	}
+	return flavor, nil
+}
+
+var bareIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// sqlKeywords are reserved in every dialect.
+var sqlKeywords = strings.Fields(`all alter and any as asc between by case cast
+	check collate column constraint create cross current_date current_time
+	current_timestamp default delete desc distinct drop else end except
+	exists false fetch for foreign from full group having in inner insert
+	intersect into is join leading left like limit natural not null on or
+	order outer primary references right select set table then to trailing
+	true union unique update using values when where with`)
+
+// reservedWords are the words each dialect won't take as a bare identifier,
+// which ident quotes.
+var reservedWords = map[sqlbuilder.Flavor]map[string]bool{
+	sqlbuilder.MySQL: set(append(strings.Fields(`accessible before bigint
+		binary blob both call change char character condition continue
+		convert current_user cursor database databases dec decimal declare
+		delayed describe div double each elseif enclosed escaped exit explain
+		float force function generated grant groups if ignore index infile int
+		integer interval iterate key keys kill lateral lead lines load lock
+		long loop match mod modifies numeric optimize option over partition
+		precision procedure purge range rank read real recursive regexp
+		release rename repeat replace require resignal restrict return revoke
+		rlike row row_number rows schema schemas separator show signal
+		smallint spatial sql ssl starting stored straight_join system
+		terminated tinyint trigger undo unlock unsigned usage utc_date
+		utc_time utc_timestamp varchar varying virtual while window write xor
+		year_month zerofill`), sqlKeywords...)),
+	sqlbuilder.PostgreSQL: set(append(strings.Fields(`analyse analyze array
+		asymmetric both current_catalog current_role current_schema
+		current_user deferrable do grant initially lateral localtime
+		localtimestamp offset only placing returning session_user some
+		symmetric user variadic window`), sqlKeywords...)),
+	sqlbuilder.SQLite: set(append(strings.Fields(`add autoincrement commit
+		deferrable escape glob index indexed initially isnull notnull nothing
+		offset raise regexp transaction`), sqlKeywords...)),
+}
+
+// ident quotes an identifier for flavor if it couldn't be written bare, as
+// with a column alias containing a space, a number like the 2024 of a
+// column per year, or a reserved word like order.
+func ident(flavor sqlbuilder.Flavor, name string) string {
+	if bareIdentifier.MatchString(name) && !reservedWords[flavor][strings.ToLower(name)] {
+		return name
+	}
+	if flavor == sqlbuilder.MySQL {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// literal renders a single value as an sql literal in flavor.
+func literal(flavor sqlbuilder.Flavor, v any) (string, error) {
+	placeholder := "?"
+	if flavor == sqlbuilder.PostgreSQL {
+		placeholder = "$1"
+	}
+	return flavor.Interpolate(placeholder, []any{v})
+}
+
+// jsonbValue renders v as a postgres jsonb literal, e.g. '{"a": 1}'::jsonb.
+func jsonbValue(v string) (any, error) {
+	if !json.Valid([]byte(v)) {
+		return nil, fmt.Errorf("invalid json %q", v)
+	}
+	lit, err := literal(sqlbuilder.PostgreSQL, v)
+	if err != nil {
+		return nil, err
+	}
+	return sqlbuilder.Raw(lit + "::jsonb"), nil
+}
+
+// arrayValue renders v as a postgres array. Values already in postgres array
+// literal syntax ({a,b}) are quoted as is; json arrays ([1, "b"]) become an
+// ARRAY[...] constructor, except the empty [], which is '{}'.
+func arrayValue(v string) (any, error) {
+	if strings.HasPrefix(v, "{") && strings.HasSuffix(v, "}") {
+		return v, nil
+	}
+	var elems []any
+	if err := json.Unmarshal([]byte(v), &elems); err != nil {
+		return nil, fmt.Errorf("expected a {...} array literal or a json array; got %q", v)
+	}
+	if len(elems) == 0 {
+		// ARRAY[] has no type to infer, but the column gives '{}' one
+		return "{}", nil
+	}
+	lits := []string{}
+	for _, elem := range elems {
+		if _, ok := elem.(map[string]any); ok {
+			return nil, fmt.Errorf("nested objects aren't supported in array %q", v)
+		}
+		if _, ok := elem.([]any); ok {
+			return nil, fmt.Errorf("nested arrays aren't supported in array %q", v)
+		}
+		lit, err := literal(sqlbuilder.PostgreSQL, elem)
+		if err != nil {
+			return nil, err
+		}
+		lits = append(lits, lit)
+	}
+	return sqlbuilder.Raw("ARRAY[" + strings.Join(lits, ", ") + "]"), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func TestIdentNumeric(t *testing.T) {
+	tests := []struct {
+		flavor    sqlbuilder.Flavor
+		name      string
+		want      string
+		wantQuery string
+	}{
+		{sqlbuilder.MySQL, "2024", "`2024`", "UPDATE t SET `2024` = 5 WHERE id = 1;"},
+		{sqlbuilder.PostgreSQL, "2024", `"2024"`, `UPDATE t SET "2024" = 5 WHERE id = 1;`},
+		{sqlbuilder.SQLite, "2024", `"2024"`, `UPDATE t SET "2024" = 5 WHERE id = 1;`},
+		{sqlbuilder.MySQL, "y2024", "y2024", "UPDATE t SET y2024 = 5 WHERE id = 1;"},
+	}
+	for _, test := range tests {
+		if got := ident(test.flavor, test.name); got != test.want {
+			t.Errorf("ident(%v, %q) = %s, want %s", test.flavor, test.name, got, test.want)
+		}
+		updates := []record{{"id": "1", test.name: "5"}}
+		stmts, err := updateQueries(updates, "t", column{"id", "id"}, queryOpts{flavor: test.flavor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(stmts) != 1 || stmts[0].String() != test.wantQuery {
+			t.Errorf("%v: got %q, want %q", test.flavor, stmts, test.wantQuery)
+		}
+	}
+}
+
+func TestIdentSpaced(t *testing.T) {
+	tests := []struct {
+		flavor sqlbuilder.Flavor
+		name   string
+		want   string
+	}{
+		{sqlbuilder.MySQL, "full name", "`full name`"},
+		{sqlbuilder.PostgreSQL, "full name", `"full name"`},
+		{sqlbuilder.SQLite, "full name", `"full name"`},
+		{sqlbuilder.MySQL, "a`b c", "`a``b c`"},
+		{sqlbuilder.PostgreSQL, `a"b c`, `"a""b c"`},
+		{sqlbuilder.MySQL, "full_name", "full_name"},
+	}
+	for _, test := range tests {
+		if got := ident(test.flavor, test.name); got != test.want {
+			t.Errorf("ident(%v, %q) = %s, want %s", test.flavor, test.name, got, test.want)
+		}
+	}
+	cols := []column{{"full name", "full name"}, {"id", "id"}}
+	updates, err := sqlRecords([]record{{"id": "1", "full name": "Ann Lee"}}, cols, nil, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := updateQueries(updates, "t", column{"id", "id"}, queryOpts{flavor: sqlbuilder.PostgreSQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `UPDATE t SET "full name" = E'Ann Lee' WHERE id = 1;`
+	if len(stmts) != 1 || stmts[0].String() != want {
+		t.Errorf("got %q, want %q", stmts, want)
+	}
+}
+
+func TestIdentReserved(t *testing.T) {
+	tests := []struct {
+		flavor sqlbuilder.Flavor
+		name   string
+		want   string
+	}{
+		{sqlbuilder.MySQL, "order", "`order`"},
+		{sqlbuilder.MySQL, "Group", "`Group`"},
+		{sqlbuilder.PostgreSQL, "order", `"order"`},
+		{sqlbuilder.SQLite, "group", `"group"`},
+		// reserved in mysql only
+		{sqlbuilder.MySQL, "key", "`key`"},
+		{sqlbuilder.PostgreSQL, "key", "key"},
+		// reserved in postgres only
+		{sqlbuilder.PostgreSQL, "user", `"user"`},
+		{sqlbuilder.MySQL, "user", "user"},
+		{sqlbuilder.MySQL, "orders", "orders"},
+	}
+	for _, test := range tests {
+		if got := ident(test.flavor, test.name); got != test.want {
+			t.Errorf("ident(%v, %q) = %s, want %s", test.flavor, test.name, got, test.want)
+		}
+	}
+}
+
+func TestArrayValue(t *testing.T) {
+	tests := []struct {
+		v    string
+		want any
+	}{
+		{"[]", "{}"},
+		{"{a,b}", "{a,b}"},
+		{`[1, "b"]`, sqlbuilder.Raw("ARRAY[1, E'b']")},
+	}
+	for _, test := range tests {
+		got, err := arrayValue(test.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("arrayValue(%q) = %#v, want %#v", test.v, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"golang.org/x/exp/maps"
+)
+
+// writeDistinct writes each distinct value of the CSV column col with its
+// count, most common first, for --distinct.
+func writeDistinct(w io.Writer, records []record, headers []string, col string) error {
+	if !set(headers)[col] {
+		return fmt.Errorf("--distinct %q isn't a CSV header", col)
+	}
+	counts := map[string]int{}
+	for _, rec := range records {
+		counts[rec[col]]++
+	}
+	vals := maps.Keys(counts)
+	sort.Slice(vals, func(i, j int) bool {
+		if counts[vals[i]] != counts[vals[j]] {
+			return counts[vals[i]] > counts[vals[j]]
+		}
+		return vals[i] < vals[j]
+	})
+	for _, v := range vals {
+		if _, err := fmt.Fprintf(w, "%v\t%q\n", counts[v], v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,5 @@
+//go:build mysql
+
+package main
+
+import _ "github.com/go-sql-driver/mysql" // for --check-db
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// filter reports whether a record is kept by a --filter-expr.
+type filter func(rec record) bool
+
+// filterParser parses expressions like
+//
+//	amount > 100 AND (status != active OR name = 'a b')
+//
+// where comparisons are numeric when both sides are numbers and otherwise
+// of strings, and AND binds tighter than OR.
+type filterParser struct {
+	tokens  []string
+	pos     int
+	headers map[string]bool
+}
+
+// newFilter parses expr, checking it only names columns in headers.
+func newFilter(expr string, headers []string) (filter, error) {
+	tokens, err := filterTokens(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{tokens: tokens, headers: set(headers)}
+	f, err := p.or()
+	if err != nil {
+		return nil, fmt.Errorf("--filter-expr %q: %w", expr, err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("--filter-expr %q: unexpected %q", expr, p.tokens[p.pos])
+	}
+	return f, nil
+}
+
+var filterOps = []string{"!=", "<=", ">=", "=", "<", ">"}
+
+// filterTokens splits expr into words, quoted strings (kept quoted), parens
+// and comparison operators.
+func filterTokens(expr string) (tokens []string, err error) {
+	rs := []rune(expr)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(rs) && rs[j] != r {
+				j++
+			}
+			if j == len(rs) {
+				return nil, fmt.Errorf("--filter-expr %q: unterminated string", expr)
+			}
+			tokens = append(tokens, string(rs[i:j+1]))
+			i = j + 1
+		default:
+			op := ""
+			for _, o := range filterOps {
+				if strings.HasPrefix(string(rs[i:]), o) {
+					op = o
+					break
+				}
+			}
+			if op != "" {
+				tokens = append(tokens, op)
+				i += len([]rune(op))
+				continue
+			}
+			j := i
+			for j < len(rs) && !unicode.IsSpace(rs[j]) && !strings.ContainsRune("()=!<>'\"", rs[j]) {
+				j++
+			}
+			if j == i {
+				return nil, fmt.Errorf("--filter-expr %q: unexpected %q", expr, string(r))
+			}
+			tokens = append(tokens, string(rs[i:j]))
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+func (p *filterParser) next() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	tok := p.tokens[p.pos]
+	p.pos++
+	return tok
+}
+
+func (p *filterParser) peekKeyword(kw string) bool {
+	return p.pos < len(p.tokens) && strings.EqualFold(p.tokens[p.pos], kw)
+}
+
+func (p *filterParser) or() (filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("OR") {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(rec record) bool { return l(rec) || right(rec) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) and() (filter, error) {
+	left, err := p.comparison()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekKeyword("AND") {
+		p.pos++
+		right, err := p.comparison()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(rec record) bool { return l(rec) && right(rec) }
+	}
+	return left, nil
+}
+
+func (p *filterParser) comparison() (filter, error) {
+	tok := p.next()
+	switch {
+	case tok == "":
+		return nil, fmt.Errorf("unexpected end")
+	case tok == "(":
+		f, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("expected \")\"")
+		}
+		return f, nil
+	case !p.headers[tok]:
+		return nil, fmt.Errorf("no column %q", tok)
+	}
+	col := tok
+	op := p.next()
+	if !set(filterOps)[op] {
+		return nil, fmt.Errorf("expected a comparison after %q; got %q", col, op)
+	}
+	val := p.next()
+	if val == "" || val == "(" || val == ")" {
+		return nil, fmt.Errorf("expected a value after %q %s", col, op)
+	}
+	if len(val) >= 2 && (val[0] == '\'' || val[0] == '"') {
+		val = val[1 : len(val)-1]
+	}
+	return func(rec record) bool {
+		return compare(rec[col], op, val)
+	}, nil
+}
+
+// compareValues compares a and b as numbers if both are, or else as
+// strings, returning -1, 0 or 1.
+func compareValues(a, b string) int {
+	af, aErr := strconv.ParseFloat(a, 64)
+	bf, bErr := strconv.ParseFloat(b, 64)
+	if aErr != nil || bErr != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compare(a, op, b string) bool {
+	c := compareValues(a, b)
+	switch op {
+	case "=":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
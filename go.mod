@@ -4,11 +4,17 @@ go 1.18
 
 require (
 	github.com/alexflint/go-arg v1.4.3
+	github.com/go-sql-driver/mysql v1.5.0
+	github.com/huandu/go-sqlbuilder v1.15.0
+	github.com/kr/pretty v0.3.0
+	github.com/lib/pq v1.9.0
+	github.com/pingcap/parser v0.0.0-20200623164729-3a18f1e5dceb
 	github.com/sunary/sqlize v0.0.0-20220724082018-aa7f506ddb85
+	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e
+	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654
 )
 
 require (
-	github.com/Masterminds/squirrel v1.5.3 // indirect
 	github.com/alexflint/go-scalar v1.1.0 // indirect
 	github.com/auxten/postgresql-parser v1.0.0 // indirect
 	github.com/certifi/gocertifi v0.0.0-20200922220541-2c3bb06c6054 // indirect
@@ -22,17 +28,11 @@ require (
 	github.com/gogo/protobuf v1.3.1 // indirect
 	github.com/golang/protobuf v1.4.3 // indirect
 	github.com/grpc-ecosystem/grpc-gateway v1.16.0 // indirect
-	github.com/huandu/go-sqlbuilder v1.15.0 // indirect
 	github.com/huandu/xstrings v1.3.2 // indirect
 	github.com/konsorten/go-windows-terminal-sequences v1.0.3 // indirect
-	github.com/kr/pretty v0.3.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
-	github.com/lann/builder v0.0.0-20180802200727-47ae307949d0 // indirect
-	github.com/lann/ps v0.0.0-20150810152359-62de8c46ede0 // indirect
-	github.com/lib/pq v1.9.0 // indirect
 	github.com/pingcap/errors v0.11.4 // indirect
 	github.com/pingcap/log v0.0.0-20210906054005-afc726e70354 // indirect
-	github.com/pingcap/parser v0.0.0-20200623164729-3a18f1e5dceb // indirect
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/rogpeppe/go-internal v1.6.1 // indirect
 	github.com/sirupsen/logrus v1.6.0 // indirect
@@ -40,9 +40,7 @@ require (
 	go.uber.org/atomic v1.9.0 // indirect
 	go.uber.org/multierr v1.7.0 // indirect
 	go.uber.org/zap v1.19.1 // indirect
-	golang.org/x/exp v0.0.0-20220722155223-a9213eeb770e // indirect
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c // indirect
-	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
 	golang.org/x/text v0.3.7 // indirect
 	google.golang.org/genproto v0.0.0-20200911024640-645f7a48b24f // indirect
 	google.golang.org/grpc v1.33.1 // indirect
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// batches splits items into consecutive batches of up to size items.
+func batches[T any](items []T, size int) [][]T {
+	if size < 1 {
+		size = 1
+	}
+	batched := [][]T{}
+	for len(items) > size {
+		batched = append(batched, items[:size])
+		items = items[size:]
+	}
+	if len(items) > 0 {
+		batched = append(batched, items)
+	}
+	return batched
+}
+
+// orderedColumns returns the sql columns of rec in the order of cols, as
+// given by --columns, matching a table.col column by its name in its own
+// table. Columns of rec not in cols, like a --hash-column, follow, sorted.
+func orderedColumns(rec record, cols []column) []string {
+	pos := map[string]int{}
+	for i, col := range cols {
+		if _, ok := pos[col.SQL]; !ok {
+			pos[col.SQL] = i
+		}
+	}
+	for i, col := range cols {
+		if _, name, ok := strings.Cut(col.SQL, "."); ok {
+			if _, ok := pos[name]; !ok {
+				pos[name] = i
+			}
+		}
+	}
+	names := sqlColumns(rec)
+	sort.SliceStable(names, func(i, j int) bool {
+		pi, iok := pos[names[i]]
+		pj, jok := pos[names[j]]
+		if iok != jok {
+			return iok
+		}
+		return iok && pi < pj
+	})
+	return names
+}
+
+// insertQueries builds inserts naming their columns in the order of cols, so
+// that they don't rely on the order of the table's columns.
+func insertQueries(inserts []record, cols []column, table string, pk column, ignore bool, opts queryOpts) (queries []statement, err error) {
+	if len(inserts) == 0 {
+		return queries, nil
+	}
+	names := orderedColumns(inserts[0], cols)
+	raw := map[string]bool{}
+	for _, asg := range opts.rawAssigns {
+		raw[asg.Col] = true
+	}
+	valueCols := []string{}
+	for _, col := range names {
+		if !raw[col] {
+			valueCols = append(valueCols, col)
+		}
+	}
+	insertCols := append([]string{}, valueCols...)
+	for _, asg := range opts.rawAssigns {
+		insertCols = append(insertCols, asg.Col)
+	}
+
+	batched := batches(inserts, opts.batchSize)
+	batchQueries := make([][]statement, len(batched))
+	errs := make([]error, len(batched))
+	parallel(len(batched), opts.parallelism, func(i int) {
+		rows := [][]any{}
+		for _, rec := range batched[i] {
+			row, err := opts.insertRow(rec, valueCols, pk)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			rows = append(rows, row)
+		}
+		batchQueries[i], errs[i] = opts.sizedInsertQueries(rows, batched[i], insertCols, table, pk, ignore)
+	})
+	for i, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, batchQueries[i]...)
+	}
+	return queries, nil
+}
+
+// sizedInsertQueries builds one insert for rows, or several if the statement
+// would grow past opts.maxStatementBytes. Each row is added in turn and the
+// statement rebuilt, so the limit applies to the final interpolated string.
+// recs are the records of rows.
+func (opts queryOpts) sizedInsertQueries(rows [][]any, recs []record, cols []string, table string, pk column, ignore bool) (queries []statement, err error) {
+	if opts.maxStatementBytes <= 0 {
+		stmt, err := opts.insertQuery(rows, cols, table, pk, ignore)
+		stmt.from(recs, pk)
+		return []statement{stmt}, err
+	}
+	start := 0
+	var last statement
+	for i := range rows {
+		stmt, err := opts.insertQuery(rows[start:i+1], cols, table, pk, ignore)
+		if err != nil {
+			return nil, err
+		}
+		if len(stmt.String()) > opts.maxStatementBytes {
+			if i > start {
+				queries = append(queries, last)
+				start = i
+				stmt, err = opts.insertQuery(rows[start:i+1], cols, table, pk, ignore)
+				if err != nil {
+					return nil, err
+				}
+			}
+			if len(stmt.String()) > opts.maxStatementBytes {
+				err := opts.warn("a single row takes %v bytes, over --max-statement-bytes %v", len(stmt.String()), opts.maxStatementBytes)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		stmt.from(recs[start:i+1], pk)
+		last = stmt
+	}
+	return append(queries, last), nil
+}
+
+// insertRow returns the values of rec for cols followed by the raw
+// assignments.
+func (opts queryOpts) insertRow(rec record, cols []string, pk column) (row []any, err error) {
+	for _, col := range cols {
+		var val any
+		if col == pk.SQL {
+			val, err = opts.pkValue(rec[col])
+		} else {
+			val, err = opts.value(col, rec[col])
+		}
+		if err != nil {
+			return row, err
+		}
+		row = append(row, val)
+	}
+	for _, asg := range opts.rawAssigns {
+		row = append(row, sqlbuilder.Raw(asg.Expr))
+	}
+	return row, nil
+}
+
+// insertQuery inserts rows of values for cols. It always lists cols, in
+// the same order as every row, so the values never depend on the order of
+// the table's own columns.
+func (opts queryOpts) insertQuery(rows [][]any, cols []string, table string, pk column, ignore bool) (stmt statement, err error) {
+	verb := "INSERT"
+	conflict := ""
+	if ignore {
+		switch opts.flavor {
+		case sqlbuilder.MySQL:
+			verb = "INSERT IGNORE"
+		case sqlbuilder.PostgreSQL, sqlbuilder.SQLite:
+			conflict = fmt.Sprintf(" ON CONFLICT (%s) DO NOTHING", sqlbuilder.Escape(ident(opts.flavor, pk.SQL)))
+		default:
+			return stmt, fmt.Errorf("%v doesn't support insert-ignore", opts.flavor)
+		}
+	}
+
+	// the builder only knows VALUES, so compile the union form by hand
+	args := &sqlbuilder.Args{}
+	rowsSQL := []string{}
+	for _, row := range rows {
+		placeholders := []string{}
+		for _, val := range row {
+			placeholders = append(placeholders, args.Add(val))
+		}
+		if opts.batchStyle == "union" {
+			rowsSQL = append(rowsSQL, "SELECT "+strings.Join(placeholders, ", "))
+		} else {
+			rowsSQL = append(rowsSQL, "("+strings.Join(placeholders, ", ")+")")
+		}
+	}
+	rowsJoined := "VALUES " + strings.Join(rowsSQL, ", ")
+	if opts.batchStyle == "union" {
+		rowsJoined = strings.Join(rowsSQL, " UNION ALL ")
+	}
+	quoted := []string{}
+	for _, col := range cols {
+		quoted = append(quoted, ident(opts.flavor, col))
+	}
+	sql := fmt.Sprintf("%s INTO %s (%s) %s%s",
+		verb, sqlbuilder.Escape(table), strings.Join(sqlbuilder.EscapeAll(quoted...), ", "), rowsJoined, conflict)
+	return opts.statement(args.CompileWithFlavor(sql, opts.flavor))
+}
+
+// valuesQueries renders each record as a bare "(v1, v2, ...)" tuple, for
+// pasting into an INSERT written elsewhere. Values are in the order of the
+// columns of insertQueries: those of cols, then any others like a
+// --hash-column, then the raw assignments.
+func valuesQueries(records []record, cols []column, pk column, opts queryOpts) (queries []statement, err error) {
+	raw := map[string]bool{}
+	for _, asg := range opts.rawAssigns {
+		raw[asg.Col] = true
+	}
+	if len(records) == 0 {
+		return queries, nil
+	}
+	// in the same order as the columns of inserts, with any --hash-column
+	valueCols := []string{}
+	for _, col := range orderedColumns(records[0], cols) {
+		if !raw[col] {
+			valueCols = append(valueCols, col)
+		}
+	}
+	for _, rec := range records {
+		row, err := opts.insertRow(rec, valueCols, pk)
+		if err != nil {
+			return queries, err
+		}
+		args := &sqlbuilder.Args{}
+		placeholders := []string{}
+		for _, val := range row {
+			placeholders = append(placeholders, args.Add(val))
+		}
+		stmt, err := opts.statement(args.CompileWithFlavor("("+strings.Join(placeholders, ", ")+")", opts.flavor))
+		if err != nil {
+			return queries, err
+		}
+		stmt.Fragment = true
+		stmt.from([]record{rec}, pk)
+		queries = append(queries, stmt)
+	}
+	return queries, nil
+}
+
+// deleteQueries deletes the rows of each record by pk, undoing an insert.
+func deleteQueries(inserts []record, table string, pk column, opts queryOpts) (queries []statement, err error) {
+	for _, rec := range inserts {
+		db := opts.flavor.NewDeleteBuilder()
+		db.DeleteFrom(table)
+		pkCond, err := opts.pkCond(&db.Cond, pk, []string{rec[pk.SQL]})
+		if err != nil {
+			return queries, err
+		}
+		db.Where(pkCond)
+		stmt, err := opts.statement(db.Build())
+		if err != nil {
+			return queries, err
+		}
+		stmt.from([]record{rec}, pk)
+		queries = append(queries, stmt)
+	}
+	return queries, nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func TestInsertQueriesColumnOrder(t *testing.T) {
+	cols := []column{{"status", "status"}, {"name", "name"}, {"score", "points"}, {"id", "id"}}
+	inserts := []record{
+		{"id": "1", "name": "a", "status": "active", "points": "5"},
+		{"id": "2", "name": "b", "status": "gone", "points": "7"},
+	}
+	opts := queryOpts{flavor: sqlbuilder.MySQL, batchSize: 2}
+	stmts, err := insertQueries(inserts, cols, "t", column{"id", "id"}, false, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "INSERT INTO t (status, name, points, id) VALUES ('active', 'a', 5, 1), ('gone', 'b', 7, 2);"
+	if len(stmts) != 1 || stmts[0].String() != want {
+		t.Errorf("got %q, want %q", stmts, want)
+	}
+}
+
+func TestOrderedColumns(t *testing.T) {
+	cols := []column{{"b", "b"}, {"other.c", "other.c"}, {"a", "a"}, {"id", "id"}}
+	tests := []struct {
+		rec  record
+		want []string
+	}{
+		{record{"id": "1", "a": "x", "b": "y"}, []string{"b", "a", "id"}},
+		// a table.col column is matched by its name in its own table
+		{record{"id": "1", "c": "z"}, []string{"c", "id"}},
+		// columns not in --columns, like a --hash-column, come last, sorted
+		{record{"id": "1", "a": "x", "hash": "h", "etag": "e"}, []string{"a", "id", "etag", "hash"}},
+		{record{"id": "1", rowKey: "2", "a": "x"}, []string{"a", "id"}},
+	}
+	for _, test := range tests {
+		if got := orderedColumns(test.rec, cols); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("orderedColumns(%q) = %q, want %q", test.rec, got, test.want)
+		}
+	}
+}
+
+func TestValuesQueriesHashColumn(t *testing.T) {
+	cols := []column{{"name", "name"}, {"id", "id"}}
+	records := []record{{"id": "1", "name": "a", "etag": "e1"}}
+	opts := queryOpts{flavor: sqlbuilder.MySQL}
+	stmts, err := valuesQueries(records, cols, column{"id", "id"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "('a', 1, 'e1')"; len(stmts) != 1 || stmts[0].String() != want {
+		t.Errorf("got %q, want %q", stmts, want)
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// lookup maps the values of a sql column through a key and value column of
+// another CSV, a small join against a lookup table.
+type lookup struct {
+	Col  string
+	Path string
+	Vals map[string]string
+	// Strict makes values without a match an error rather than passing them
+	// through unchanged.
+	Strict bool
+}
+
+// newLookup parses "col:lookup.csv:keycol:valcol" and loads the lookup file.
+func newLookup(lookupstring string, strict bool) (lk lookup, err error) {
+	parts := strings.Split(lookupstring, ":")
+	if len(parts) != 4 || parts[0] == "" || parts[1] == "" {
+		return lk, fmt.Errorf("expected \"col:lookup.csv:keycol:valcol\"; got %q", lookupstring)
+	}
+	col, path, keyCol, valCol := parts[0], parts[1], parts[2], parts[3]
+
+	f, err := os.Open(path)
+	if err != nil {
+		return lk, err
+	}
+	defer f.Close()
+	lines, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return lk, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(lines) == 0 {
+		return lk, fmt.Errorf("%s: no header row", path)
+	}
+	keyIdx, valIdx := -1, -1
+	for i, header := range lines[0] {
+		switch header {
+		case keyCol:
+			keyIdx = i
+		case valCol:
+			valIdx = i
+		}
+	}
+	if keyIdx < 0 || valIdx < 0 {
+		return lk, fmt.Errorf("%s: expected columns %q and %q in header %q", path, keyCol, valCol, lines[0])
+	}
+
+	lk = lookup{Col: col, Path: path, Vals: map[string]string{}, Strict: strict}
+	for _, line := range lines[1:] {
+		lk.Vals[line[keyIdx]] = line[valIdx]
+	}
+	return lk, nil
+}
+
+func lookups(lookupstrings []string, strict bool) (lks []lookup, err error) {
+	for _, lookupstring := range lookupstrings {
+		lk, err := newLookup(lookupstring, strict)
+		if err != nil {
+			return lks, err
+		}
+		lks = append(lks, lk)
+	}
+	return lks, nil
+}
+
+// apply looks up v, leaving empty values alone so they stay NULL.
+func (lk lookup) apply(v string) (string, error) {
+	if v == "" {
+		return v, nil
+	}
+	if val, ok := lk.Vals[v]; ok {
+		return val, nil
+	}
+	if lk.Strict {
+		return v, fmt.Errorf("column %q value %q has no match in %s", lk.Col, v, lk.Path)
+	}
+	return v, nil
+}
@@ -1,12 +1,27 @@
 package main
 
 import (
+	"bufio"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"math"
+	"math/rand"
 	"os"
+	"path"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"text/tabwriter"
+	"text/template"
+	"time"
+	"unicode"
 
 	"github.com/alexflint/go-arg"
 	"github.com/huandu/go-sqlbuilder"
@@ -15,16 +30,114 @@ import (
 )
 
 type args struct {
-	CSVPath         string   `arg:"positional,required" placeholder:"CSV"`
-	CsvPK           string   `arg:"--pk,required"`
-	Table           string   `arg:"-t,required"`
-	Columns         []string `arg:"-c,required" help:"to provide an alias in the output sql, use the format \"csvcol->sqlcol\""`
-	ValueTransforms []string `arg:"-f" help:"transform values: \"csvval->sqlval\""`
-	Verbose         bool     `arg:"-v"`
+	CSVPath            string   `arg:"positional" placeholder:"CSV"`
+	InputGlob          string   `arg:"--input-glob" help:"read every CSV matching this pattern, e.g. 'exports/*.csv', in name order as one CSV instead of CSV; all must have the same headers"`
+	CsvPK              string   `arg:"--pk,required" help:"the pk column; \"#index\" or \"#index->sqlcol\" gives it by zero-based field index, as --columns-by-index does"`
+	NullPK             bool     `arg:"--null-pk" help:"match rows whose pk IS NULL for records with an empty pk"`
+	NullMatch          bool     `arg:"--null-match" help:"match rows whose --match-columns column IS NULL for records with an empty value in it, rather than erroring"`
+	PKType             string   `arg:"--pk-type" help:"emit the pk as an int, string or uuid rather than inferring its type"`
+	Table              string   `arg:"-t,required"`
+	Template           string   `help:"write each record with this go text/template instead of --mode statements, supplying its own terminator; it has .Table, .PK, .Fields, .Value col to render a column as sql, and the functions quote and ident"`
+	Mode               string   `default:"update" help:"statements to generate: update, update-case (one UPDATE per column, SET col = CASE pk WHEN ... END), insert, insert-ignore (INSERT IGNORE, or ON CONFLICT (pk) DO NOTHING), create-table (DDL with types inferred from the CSV), values (just the value tuples), copy (postgres COPY FROM STDIN with the rows inline, for psql) or load-data (mysql LOAD DATA LOCAL INFILE of a csv written to --load-data-dir)"`
+	BatchSize          int      `arg:"--batch-size" default:"1" help:"rows per INSERT statement, or per --mode update-case statement if more than 1"`
+	BatchStyle         string   `arg:"--batch-style" default:"values" help:"how to batch INSERT rows: values, or union for INSERT ... SELECT ... UNION ALL SELECT ..., which can't take --default-column"`
+	MaxStatementBytes  int      `arg:"--max-statement-bytes" help:"start a new INSERT before a batch exceeds this many bytes, e.g. to stay under max_allowed_packet"`
+	Dialect            string   `default:"mysql" help:"sql dialect: mysql, postgresql or sqlite"`
+	OutputDialect      string   `arg:"--output-dialect" help:"dialect to generate statements in, if not --dialect"`
+	TablePrefix        string   `arg:"--table-prefix" help:"prepended to the table name, e.g. to target staging tables"`
+	TableSuffix        string   `arg:"--table-suffix" help:"appended to the table name"`
+	Columns            []string `arg:"-c" help:"to provide an alias in the output sql, use the format \"csvcol->sqlcol\"; a csv column may be given several aliases; \"table.csvcol\" sets the column in that table instead of --table, matching rows on the same --pk"`
+	ColumnsByIndex     []string `arg:"--columns-by-index" help:"select columns by zero-based field index rather than header: \"index->sqlcol\"; for garbled headers, or with --no-header"`
+	NoHeader           bool     `arg:"--no-header" help:"read row 1 as data, for a CSV without a header; columns and the pk must then be given by index, with sql aliases"`
+	IncludeGlobs       []string `arg:"--include-glob" help:"add the csv columns matching a glob, other than the pk, e.g. \"attr_*\", or \"attr_*->a_*\" to rename them"`
+	RenameMap          string   `arg:"--rename-map" help:"CSV of \"csvcol,sqlcol\" renames, after a header row, to use as columns"`
+	AllColumns         bool     `arg:"--all-columns" help:"use every CSV column, renamed by --rename-map if listed there"`
+	MapSep             string   `arg:"--map-sep" default:"->" help:"separator between csv and sql names in columns and value transforms, for data containing \"->\""`
+	KeepOriginal       bool     `arg:"--keep-original" help:"also set each aliased column under its csv name, e.g. while old and new columns coexist"`
+	ValueTransforms    []string `arg:"-f" help:"transform values: \"csvval->sqlval\"; an empty sqlval, as in \"N/A->\", is then treated like an empty csv value, so NULL by default"`
+	NAValues           []string `arg:"--na-values" help:"treat these values as empty, so NULL by default, like -f \"NA->\"; default stands for pandas' set: #N/A, #N/A N/A, #NA, -1.#IND, -1.#QNAN, -NaN, -nan, 1.#IND, 1.#QNAN, <NA>, N/A, NA, NULL, NaN, None, n/a, nan, null and -. With --ci-values they match regardless of case"`
+	NullLiteral        bool     `arg:"--null-literal-passthrough" help:"write the csv value \\NULL as the string 'NULL'; this comes before value transforms, lookups and every other rule, so it holds even with a transform like NULL-> making the text NULL an sql NULL"`
+	CIValues           bool     `arg:"--ci-values" help:"match now() and -f value transforms regardless of case"`
+	HashColumn         string   `arg:"--hash-column" help:"set this column to a sha256 hex of each record's sql columns and values, for change detection"`
+	AssignRaw          []string `arg:"--assign-raw" help:"assign a raw sql expression in every statement: \"col=expr\""`
+	RawColumns         []string `arg:"--raw-column" help:"pass values of these columns through as raw sql expressions"`
+	FuncColumns        []string `arg:"--raw-function-column" help:"emit values of these columns that look like function calls, e.g. ST_GeomFromText('POINT(1 2)'), as raw sql, warning about others"`
+	HexColumns         []string `arg:"--hex-column" help:"emit values of these columns as unquoted hex literals, e.g. 0xDEADBEEF"`
+	JSONColumns        []string `arg:"--json-column" help:"emit values of these columns as jsonb (postgresql only)"`
+	ArrayColumns       []string `arg:"--array-column" help:"emit values of these columns, as {a,b} literals or json arrays, as arrays (postgresql only)"`
+	EmptyStringColumns []string `arg:"--empty-string-column" help:"set empty values of these columns to '' rather than NULL"`
+	DefaultColumns     []string `arg:"--default-column" help:"set empty values of these columns to DEFAULT rather than NULL; not with --mode update-case or --batch-style union"`
+	Lookups            []string `arg:"--lookup" help:"map a sql column's values through another CSV, as col:lookup.csv:keycol:valcol"`
+	LookupStrict       bool     `arg:"--lookup-strict" help:"error on values with no match in their --lookup file rather than passing them through"`
+	Types              []string `arg:"--type" help:"declare sql column types instead of inferring them: \"col:int|float|bool|string\""`
+	AutoDate           bool     `arg:"--auto-date" help:"rewrite values in common date and datetime formats, e.g. 1/31/2024 14:05 or 31-Jan-2024, as ISO 8601; slashed dates are read month first"`
+	StripCurrency      bool     `arg:"--strip-currency" help:"remove currency symbols from values like $1,234.56 or 1.234,56 €, and their thousands separators per --number-locale, or en if not given"`
+	NumberLocale       string   `arg:"--number-locale" help:"parse numbers as written in a locale before coercion: en, de (1.234,56), fr (1 234,56) or ch (1'234.56)"`
+	LenientTypes       bool     `arg:"--lenient-types" help:"warn and fall back to inference when a value doesn't parse as its declared type"`
+	NoInterpolate      bool     `arg:"--no-interpolate" help:"leave placeholders in the sql and list the values in a trailing comment"`
+	GroupIdentical     bool     `arg:"--group-identical" help:"update records with identical values in one statement using WHERE pk IN (...)"`
+	MappingRow         bool     `arg:"--mapping-row" help:"read sql column aliases for the header from the second row of the CSV"`
+	TypesRow           bool     `arg:"--types-row" help:"read column types (int, float, bool or string) from the row after the header, or after the mapping row"`
+	AllowRagged        bool     `arg:"--allow-ragged" help:"read missing trailing fields of rows shorter than the header as NULL rather than failing"`
+	SkipAbsent         bool     `arg:"--skip-absent" help:"with --allow-ragged, leave the missing trailing fields of short rows unchanged rather than setting them to NULL"`
+	HealShifts         string   `arg:"--heal-shifts" placeholder:"COL" help:"rejoin this text column with the next field in rows with one field too many, as from an unescaped delimiter, rejoined with it; warns on each heal"`
+	TrimEmptyColumns   bool     `arg:"--trim-trailing-empty-columns" help:"drop trailing header columns with empty names, and their fields, as Excel exports often add"`
+	AutoDelimiter      bool     `arg:"--auto-delimiter" help:"read fields delimited by whichever of comma, tab, semicolon or pipe splits the first lines into the most fields, consistently"`
+	RetryDelimiters    bool     `arg:"--retry-delimiters" help:"if rows have the wrong number of fields, retry reading the CSV with tab, semicolon and pipe delimiters, reporting the one that works"`
+	ExpectColumns      int      `arg:"--expect-columns" placeholder:"N" help:"fail unless the CSV header has exactly N fields, to catch a changed export"`
+	ExpectHeader       string   `arg:"--expect-header" help:"fail unless the CSV header is exactly these comma-separated names, in order, after any --normalize-headers, listing the columns added, removed or reordered"`
+	NormalizeHeaders   bool     `arg:"--normalize-headers" help:"trim and lowercase the CSV headers and replace each run of spaces and hyphens with an underscore, e.g. \"First Name\" becomes first_name; other flags then name columns by the normalized headers"`
+	FailFast           bool     `arg:"--fail-fast" help:"report the record index and raw line of the first malformed CSV row"`
+	CSVReuseRecord     bool     `arg:"--csv-reuse-record" default:"true" help:"reuse the CSV reader's row buffer to allocate less; pass =false to disable"`
+	FilterExpr         string   `arg:"--filter-expr" help:"keep only records matching an expression of csv columns, e.g. \"amount > 100 AND (status != active OR name = 'a b')\""`
+	DedupeBy           []string `arg:"--dedupe-by" help:"keep only one record for each distinct combination of these csv columns"`
+	Keep               string   `default:"last" help:"which record --dedupe-by keeps: first or last"`
+	PKGenerate         *int64   `arg:"--pk-generate" placeholder:"START" help:"give each record a sequential integer pk from START, replacing any from the CSV, for inserts into a table with a surrogate key; the last one is reported on stderr"`
+	SkipMissingPK      bool     `arg:"--skip-missing-pk" help:"drop records with an empty pk instead of generating statements for them"`
+	SortBy             []string `arg:"--sort-by" help:"order statements by these sql columns, comparing numbers numerically, rather than by pk"`
+	SortDesc           bool     `arg:"--sort-desc" help:"reverse the --sort-by order"`
+	Sample             int      `help:"emit statements for a random sample of N records"`
+	Seed               *int64   `help:"random seed for --sample, for reproducible samples"`
+	Base               string   `help:"CSV of the current values of the rows being updated, to generate inverse statements from"`
+	ColumnOrder        []string `arg:"--column-order" help:"in updates, SET these sql columns first, in this order, and the rest after them alphabetically; commas are allowed"`
+	MatchColumns       []string `arg:"--match-columns" help:"match updated rows on these csv columns, AND-ed, rather than the pk; \"csvcol->sqlcol\" aliases and commas are allowed"`
+	UpdateLimit1       bool     `arg:"--update-limit-1" help:"append LIMIT 1 to each update, so a pk that isn't unique in the table still changes one row; mysql output only"`
+	EmitNoops          bool     `arg:"--emit-empty-update-as-noop" help:"write a \"-- noop for pk=X\" comment for records with nothing to SET, rather than skipping them"`
+	GuardColumns       []string `arg:"--guard-column" help:"only update rows whose columns still have their --base values: \"csvcol->sqlcol\""`
+	DownOut            string   `arg:"--down-out" help:"write statements restoring the --base values to this file"`
+	Migration          string   `help:"write golang-migrate style NNN_name.up.sql/.down.sql files named NAME to --out"`
+	LoadDataDir        string   `arg:"--load-data-dir" help:"directory to write the csv files of --mode load-data to, if not --out"`
+	Out                string   `help:"directory to write output files to"`
+	OutputPerTable     bool     `arg:"--output-per-table" help:"write each table's statements to TABLE.sql in --out, in running order, with a manifest.json unless --manifest"`
+	PartitionBy        string   `arg:"--partition-by" help:"write the statements for each value of this sql column to shard_VALUE.sql in --out, with a manifest.json unless --manifest; an empty VALUE, or one with characters unsafe in a file name, is sanitized and suffixed with a hash of it"`
+	Manifest           string   `help:"write a json manifest of the output files, their statement counts and sha256 sums to this file"`
+	CommentColumn      string   `arg:"--comment-column" placeholder:"COL" help:"write this CSV column's values as a trailing -- comment on their statements rather than assigning them, with newlines escaped"`
+	Annotate           bool     `help:"precede each statement with a comment naming its CSV rows and pks"`
+	Savepoints         bool     `help:"wrap each statement in its own SAVEPOINT within a transaction, released after it. No ROLLBACK TO SAVEPOINT is written, since sql can't run one only on error; on postgres the first error aborts the transaction unless the client rolls back to the savepoint itself, as psql's ON_ERROR_ROLLBACK does"`
+	NoFinalSemicolon   bool     `arg:"--no-final-semicolon" help:"leave the ; off the last statement, for consumers that terminate statements themselves"`
+	SafeWrap           bool     `arg:"--safe-wrap" help:"wrap the output in a transaction that ends in ROLLBACK, after a commented-out COMMIT to uncomment once the script is reviewed"`
+	SQLMode            string   `arg:"--sql-mode" help:"start the output with SET SESSION sql_mode to this, e.g. NO_AUTO_VALUE_ON_ZERO,ALLOW_INVALID_DATES; mysql only"`
+	Script             bool     `help:"wrap the output in SET autocommit=0 / COMMIT for sourcing with the mysql client; mysql only"`
+	Parallelism        int      `default:"1" help:"number of goroutines building statements"`
+	FlushEvery         int      `arg:"--flush-every" help:"flush output every N statements rather than only when the buffer fills"`
+	Preview            int      `help:"print the first N transformed records to stderr"`
+	Distinct           string   `arg:"--distinct" placeholder:"COL" help:"print the distinct values of this CSV column with their counts, most common first, and exit without generating sql"`
+	PlanJSON           bool     `arg:"--plan-json" help:"write the resolved columns, pk, transforms, mode and dialects as JSON to stdout and exit without generating sql"`
+	ExplainSQL         bool     `arg:"--explain-sql" help:"prefix each statement with EXPLAIN, or EXPLAIN QUERY PLAN for sqlite, e.g. to check index use on a --sample"`
+	VerifySQL          bool     `arg:"--verify-sql" help:"check that every generated statement parses"`
+	CheckDB            string   `arg:"--check-db" placeholder:"DSN" help:"run the statements against this database in a transaction that's rolled back, reporting those it rejects; needs a build with -tags mysql or postgres. Not for --mode create-table on mysql, which commits DDL regardless"`
+	CheckDBEnv         string   `arg:"--check-db-env" placeholder:"VAR" help:"--check-db the DSN in this environment variable, keeping its password out of shell history and process listings"`
+	ConfirmOver        int      `arg:"--confirm-over" help:"ask before writing more than N statements; aborts without a terminal unless --yes"`
+	Yes                bool     `arg:"-y,--yes" help:"answer yes to every prompt, for scripted runs"`
+	ExitOnEmpty        bool     `arg:"--exit-on-empty" help:"exit non-zero if no statements are generated"`
+	Profile            bool     `help:"print how long each phase took to stderr"`
+	Strict             bool     `help:"treat warnings as errors"`
+	Verbose            bool     `arg:"-v" help:"log progress and debug dumps to stderr; warnings are logged regardless"`
+	NoColor            bool     `arg:"--no-color" help:"don't use terminal escapes in verbose output (the default when stderr isn't a terminal)"`
 }
 
 func (args) Description() string {
-	return "Converts a CSV file to a set of SQL updates"
+	return "Converts a CSV file to a set of SQL updates or inserts"
 }
 
 type transform struct {
@@ -32,22 +145,24 @@ type transform struct {
 	SQL string
 }
 
-func newTransform(tfstring string) (tf transform, err error) {
-	names := strings.Split(tfstring, "->")
+// newTransform parses "csv->sql", or just "name" for both, where "->" is
+// the --map-sep separator sep.
+func newTransform(tfstring, sep string) (tf transform, err error) {
+	names := strings.Split(tfstring, sep)
 	switch len(names) {
 	case 1:
 		return transform{names[0], names[0]}, nil
 	case 2:
 		return transform{names[0], names[1]}, nil
 	default:
-		return tf, fmt.Errorf("at most two \"->\" allowed; got %q", tfstring)
+		return tf, fmt.Errorf("at most one %q allowed; got %q", sep, tfstring)
 	}
 }
 
-func transforms(tfstrings []string) (transforms []transform, err error) {
+func transforms(tfstrings []string, sep string) (transforms []transform, err error) {
 	transforms = []transform{}
 	for _, tfstring := range tfstrings {
-		tf, err := newTransform(tfstring)
+		tf, err := newTransform(tfstring, sep)
 		if err != nil {
 			return transforms, err
 		}
@@ -56,15 +171,36 @@ func transforms(tfstrings []string) (transforms []transform, err error) {
 	return transforms, nil
 }
 
+// defaultNAValues are the --na-values given as "default": pandas' NA values,
+// along with "-".
+var defaultNAValues = []string{
+	"#N/A", "#N/A N/A", "#NA", "-1.#IND", "-1.#QNAN", "-NaN", "-nan", "1.#IND",
+	"1.#QNAN", "<NA>", "N/A", "NA", "NULL", "NaN", "None", "n/a", "nan", "null", "-",
+}
+
+// naTransforms transforms each of naValues to an empty value, and so to
+// NULL, expanding "default" to defaultNAValues.
+func naTransforms(naValues []string) []transform {
+	tfs := []transform{}
+	for _, na := range naValues {
+		if na == "default" {
+			tfs = append(tfs, naTransforms(defaultNAValues)...)
+		} else {
+			tfs = append(tfs, transform{na, ""})
+		}
+	}
+	return tfs
+}
+
 type column transform
 
-func newColumn(colstring string) (column, error) {
-	tf, err := newTransform(colstring)
+func newColumn(colstring, sep string) (column, error) {
+	tf, err := newTransform(colstring, sep)
 	return column(tf), err
 }
 
-func columns(colstrings []string) (cols []column, err error) {
-	tfs, err := transforms(colstrings)
+func columns(colstrings []string, sep string) (cols []column, err error) {
+	tfs, err := transforms(colstrings, sep)
 	if err != nil {
 		return cols, err
 	}
@@ -74,6 +210,272 @@ func columns(colstrings []string) (cols []column, err error) {
 	return cols, nil
 }
 
+// assignment is a column set to a raw sql expression in every statement,
+// regardless of the CSV.
+type assignment struct {
+	Col  string
+	Expr string
+}
+
+func assignments(asgstrings []string) (asgs []assignment, err error) {
+	asgs = []assignment{}
+	for _, asgstring := range asgstrings {
+		col, expr, ok := strings.Cut(asgstring, "=")
+		if !ok || col == "" {
+			return asgs, fmt.Errorf("expected \"col=expr\"; got %q", asgstring)
+		}
+		asgs = append(asgs, assignment{col, expr})
+	}
+	return asgs, nil
+}
+
+var columnTypeNames = []string{"int", "float", "bool", "string"}
+
+// columnTypes parses "col:type" declarations, which may also be given
+// comma-separated, into a map from sql column to type name.
+func columnTypes(typestrings []string) (types map[string]string, err error) {
+	types = map[string]string{}
+	for _, typestring := range typestrings {
+		for _, decl := range strings.Split(typestring, ",") {
+			col, typ, ok := strings.Cut(decl, ":")
+			if !ok || col == "" {
+				return types, fmt.Errorf("expected \"col:type\"; got %q", decl)
+			}
+			if !set(columnTypeNames)[typ] {
+				return types, fmt.Errorf("unknown type %q for column %q; expected one of %v", typ, col, columnTypeNames)
+			}
+			types[col] = typ
+		}
+	}
+	return types, nil
+}
+
+// coerce parses v as the named column type.
+func coerce(v, typ string) (val any, err error) {
+	switch typ {
+	case "int":
+		if n, ok := sciNumber(v); ok {
+			if intVal, ok := n.(int64); ok {
+				return intVal, nil
+			}
+		}
+		return strconv.ParseInt(v, 10, 64)
+	case "float":
+		return strconv.ParseFloat(v, 64)
+	case "bool":
+		return strconv.ParseBool(v)
+	default:
+		return v, nil
+	}
+}
+
+// numberLocale is how a locale writes numbers, for --number-locale.
+type numberLocale struct {
+	thousands string
+	decimal   string
+	pattern   *regexp.Regexp
+}
+
+func newNumberLocale(thousands, decimal string) numberLocale {
+	t, d := regexp.QuoteMeta(thousands), regexp.QuoteMeta(decimal)
+	return numberLocale{thousands, decimal,
+		regexp.MustCompile(`^[+-]?(\d{1,3}(` + t + `\d{3})+|\d+)(` + d + `\d+)?$`)}
+}
+
+var numberLocales = map[string]numberLocale{
+	"en": newNumberLocale(",", "."),
+	"de": newNumberLocale(".", ","),
+	"fr": newNumberLocale(" ", ","),
+	"ch": newNumberLocale("'", "."),
+}
+
+// normalize rewrites v as a plain number, like 1.234,56 to 1234.56 in de,
+// if it's a number in the locale. Anything else is returned unchanged.
+func (loc numberLocale) normalize(v string) string {
+	if !loc.pattern.MatchString(v) {
+		return v
+	}
+	v = strings.ReplaceAll(v, loc.thousands, "")
+	return strings.Replace(v, loc.decimal, ".", 1)
+}
+
+// stripCurrency removes the currency symbols, and any spaces between them
+// and the number, from either end of v, e.g. "$1,234.56" or "1.234,56 €",
+// and normalizes the number left in loc. It reports whether v was such an
+// amount, leaving v unchanged if not, so "$5 off" or "€ sale" stay text.
+func stripCurrency(v string, loc numberLocale) (string, bool) {
+	isCurrency := func(r rune) bool { return unicode.Is(unicode.Sc, r) }
+	if strings.IndexFunc(v, isCurrency) < 0 {
+		return v, false
+	}
+	s, sign := v, ""
+	if strings.HasPrefix(s, "-") {
+		s, sign = s[1:], "-"
+	}
+	amount := sign + strings.TrimFunc(s, func(r rune) bool {
+		return isCurrency(r) || unicode.IsSpace(r)
+	})
+	if !loc.pattern.MatchString(amount) {
+		return v, false
+	}
+	return loc.normalize(amount), true
+}
+
+// rowKey is the record key of a CSV record's row number, for --annotate.
+// The leading NUL keeps it from colliding with any real header, and marks
+// it as a meta key: sqlRecords carries it over, but it's never a column.
+const rowKey = "\x00row"
+
+// noteKey is the record key of a record's --comment-column value.
+const noteKey = "\x00note"
+
+// metaKeys are the record keys that describe a record rather than hold one
+// of its values.
+var metaKeys = []string{rowKey, noteKey}
+
+func isMetaKey(key string) bool {
+	return strings.HasPrefix(key, "\x00")
+}
+
+// hasColumn reports whether any of records has the sql column col. With
+// --skip-absent, records don't all have the same columns.
+func hasColumn(records []record, col string) bool {
+	if isMetaKey(col) {
+		return false
+	}
+	for _, rec := range records {
+		if _, ok := rec[col]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlColumns returns the sorted sql columns of rec, leaving out meta keys.
+func sqlColumns(rec record) []string {
+	cols := []string{}
+	for col := range rec {
+		if !isMetaKey(col) {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	return cols
+}
+
+// indexKey is the record key of the field at index i, for --columns-by-index.
+func indexKey(i int) string {
+	return fmt.Sprintf("#%d", i)
+}
+
+// indexColumns parses "index->sqlcol" columns, which may also be given
+// comma-separated. Columns without an alias take their header's name.
+func indexColumns(colstrings []string, headers []string, sep string) (cols []column, err error) {
+	for _, colstring := range colstrings {
+		for _, s := range strings.Split(colstring, ",") {
+			col, err := newColumn(s, sep)
+			if err != nil {
+				return cols, err
+			}
+			i, err := strconv.Atoi(col.CSV)
+			if err != nil || i < 0 {
+				return cols, fmt.Errorf("expected a field index; got %q", col.CSV)
+			}
+			if i >= len(headers) {
+				return cols, fmt.Errorf("field index %v out of range; the CSV has %v fields", i, len(headers))
+			}
+			if col.SQL == col.CSV {
+				if headers[i] == indexKey(i) {
+					// a headerless CSV's headers are its index keys
+					return cols, fmt.Errorf("field index %v needs a \"%v%vsqlcol\" alias, as the CSV has no header", i, i, sep)
+				}
+				col.SQL = headers[i]
+			}
+			col.CSV = indexKey(i)
+			cols = append(cols, col)
+		}
+	}
+	return cols, nil
+}
+
+// isIndexPK reports whether the pk is given by field index, as "#index" or
+// "#index->sqlcol".
+func isIndexPK(pk column) bool {
+	i, err := strconv.Atoi(strings.TrimPrefix(pk.CSV, "#"))
+	return strings.HasPrefix(pk.CSV, "#") && err == nil && i >= 0
+}
+
+// indexPK resolves a pk given by field index like indexColumns, taking its
+// header's name without an alias.
+func indexPK(pk column, headers []string, sep string) (column, error) {
+	spec := strings.TrimPrefix(pk.CSV, "#")
+	if pk.SQL != pk.CSV {
+		spec += sep + pk.SQL
+	}
+	cols, err := indexColumns([]string{spec}, headers, sep)
+	if err != nil {
+		return pk, fmt.Errorf("--pk: %w", err)
+	}
+	return cols[0], nil
+}
+
+// globColumns selects the headers matching "pattern" or "pattern->sqlpattern"
+// globs, in path.Match syntax, other than the pk. A sqlpattern's * is
+// replaced with what the pattern's single * matched, so "attr_*->a_*" maps
+// attr_size to a_size.
+func globColumns(globs []string, headers []string, pk column, sep string) (cols []column, err error) {
+	for _, glob := range globs {
+		tf, err := newTransform(glob, sep)
+		if err != nil {
+			return cols, err
+		}
+		if _, err := path.Match(tf.CSV, ""); err != nil {
+			return cols, fmt.Errorf("bad glob %q: %w", tf.CSV, err)
+		}
+		renamed := tf.SQL != tf.CSV
+		prefix, suffix, _ := strings.Cut(tf.CSV, "*")
+		if renamed && (strings.Count(tf.CSV, "*") != 1 || strings.ContainsAny(tf.CSV, "?[\\")) {
+			return cols, fmt.Errorf("renaming glob %q must have a single * and no other wildcards", tf.CSV)
+		}
+		for _, header := range headers {
+			if ok, _ := path.Match(tf.CSV, header); !ok || header == pk.CSV {
+				continue
+			}
+			sqlCol := header
+			if renamed {
+				matched := strings.TrimSuffix(strings.TrimPrefix(header, prefix), suffix)
+				sqlCol = strings.Replace(tf.SQL, "*", matched, 1)
+			}
+			cols = append(cols, column{header, sqlCol})
+		}
+	}
+	return cols, nil
+}
+
+// renameMap reads columns from a CSV of "csvcol,sqlcol" renames after a
+// header row.
+func renameMap(path string) (cols []column, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return cols, err
+	}
+	defer f.Close()
+
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = 2
+	lines, err := reader.ReadAll()
+	if err != nil {
+		return cols, fmt.Errorf("%s: %w", path, err)
+	}
+	if len(lines) > 0 {
+		lines = lines[1:]
+	}
+	for _, line := range lines {
+		cols = append(cols, column{line[0], line[1]})
+	}
+	return cols, nil
+}
+
 type record map[string]string
 
 func head[T any](lines []T, n int) []T {
@@ -84,158 +486,2060 @@ func head[T any](lines []T, n int) []T {
 	return lines[:end]
 }
 
-func csvRecords(csvPath string) (records []record, err error) {
-	records = []record{}
+func sample[T any](items []T, n int, rng *rand.Rand) []T {
+	if len(items) <= n {
+		return items
+	}
+	picked := make([]T, len(items))
+	copy(picked, items)
+	rng.Shuffle(len(picked), func(i, j int) {
+		picked[i], picked[j] = picked[j], picked[i]
+	})
+	return picked[:n]
+}
+
+// csvOpts controls how the CSV file is read.
+type csvOpts struct {
+	// failFast reports the record index and raw line of a parse error
+	failFast bool
+	// mappingRow reads the row after the header as sql aliases for the
+	// header's columns
+	mappingRow bool
+	// typesRow reads the next row, after any mapping row, as column types
+	typesRow bool
+	// indexKeys also keys each field by its index, see indexKey
+	indexKeys bool
+	// noHeader reads the first row as data, keying fields only by index
+	noHeader bool
+	// reuseRecord sets csv.Reader.ReuseRecord to save allocating each row
+	reuseRecord bool
+	// allowRagged accepts rows shorter than the header, reading their
+	// missing trailing fields as empty, i.e. NULL
+	allowRagged bool
+	// skipAbsent leaves the missing fields of short rows out of their
+	// records entirely
+	skipAbsent bool
+	// healCol is a text column whose values may contain an unescaped
+	// delimiter. Rows with one field too many have that field rejoined with
+	// the next.
+	healCol string
+	// warn reports each healed row
+	warn func(format string, a ...any) error
+	// trimEmpty drops trailing header columns with empty names, and
+	// their fields, as Excel exports often have
+	trimEmpty bool
+	// normHeaders renames headers with normalizeHeader
+	normHeaders bool
+	// comma, if set, is the field delimiter rather than ','
+	comma rune
+	// expectCols, if not 0, is the number of fields the header must have
+	expectCols int
+	// wantHeader, if any, is the header the CSV must have, after any
+	// normHeaders
+	wantHeader []string
+}
+
+// csvFile is a parsed CSV file.
+type csvFile struct {
+	headers []string
+	// mapping holds the columns named by the mapping row, if any
+	mapping []column
+	// types holds the declared type of csv columns from the types row
+	types   map[string]string
+	records []record
+}
+
+// rawLine returns line n (1-based) of the file at path.
+func rawLine(path string, n int) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<24)
+	for i := 1; scanner.Scan(); i++ {
+		if i == n {
+			return scanner.Text(), nil
+		}
+	}
+	return "", scanner.Err()
+}
+
+// headerDiff describes how the header got differs from want: the columns
+// added and removed, or if there are neither, that they're reordered. It's
+// empty if they match.
+func headerDiff(want, got []string) string {
+	wanted, have := set(want), set(got)
+	diffs := []string{}
+	added, removed := []string{}, []string{}
+	for _, h := range got {
+		if !wanted[h] {
+			added = append(added, h)
+		}
+	}
+	for _, h := range want {
+		if !have[h] {
+			removed = append(removed, h)
+		}
+	}
+	if len(added) > 0 {
+		diffs = append(diffs, fmt.Sprintf("added %q", added))
+	}
+	if len(removed) > 0 {
+		diffs = append(diffs, fmt.Sprintf("removed %q", removed))
+	}
+	if len(diffs) == 0 && strings.Join(want, "\x00") != strings.Join(got, "\x00") {
+		diffs = append(diffs, fmt.Sprintf("reordered as %q", got))
+	}
+	return strings.Join(diffs, ", ")
+}
+
+var headerSeparators = regexp.MustCompile(`[\s-]+`)
+
+// normalizeHeader trims a header, lowercases it and replaces each run of
+// spaces and hyphens with an underscore, so "First Name" is first_name.
+func normalizeHeader(header string) string {
+	return headerSeparators.ReplaceAllString(strings.ToLower(strings.TrimSpace(header)), "_")
+}
+
+func readCSV(csvPath string, opts csvOpts) (file csvFile, err error) {
+	file.records = []record{}
 
 	f, err := os.Open(csvPath)
 	if err != nil {
-		return records, err
+		return file, err
 	}
 	defer f.Close()
 
 	reader := csv.NewReader(f)
-	lines, err := reader.ReadAll()
-	if err != nil {
-		return records, err
+	if opts.comma != 0 {
+		reader.Comma = opts.comma
+	}
+	// the returned line is only valid until the next read with reuseRecord
+	reader.ReuseRecord = opts.reuseRecord
+	if opts.allowRagged || opts.healCol != "" {
+		reader.FieldsPerRecord = -1
+	}
+	read := func(row string) ([]string, error) {
+		line, err := reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if !opts.failFast || !errors.As(err, &parseErr) {
+				return line, err
+			}
+			raw, rawErr := rawLine(csvPath, parseErr.StartLine)
+			if rawErr != nil {
+				return line, err
+			}
+			return line, fmt.Errorf("%s: %w\n%s", row, err, raw)
+		}
+		// encoding/csv normally handles \r\n, but a stray \r can survive on
+		// the last field of Windows exports, so strip it everywhere
+		for i, field := range line {
+			line[i] = strings.TrimSuffix(field, "\r")
+		}
+		return line, nil
 	}
 
-	csvHeaders := lines[0]
-	for _, line := range lines[1:] {
-		record := map[string]string{}
+	csvHeaders, err := read("header")
+	if err == io.EOF {
+		return file, fmt.Errorf("%s: no header row", csvPath)
+	}
+	if err != nil {
+		return file, err
+	}
+	csvHeaders = append([]string{}, csvHeaders...)
+	var first []string
+	if opts.noHeader {
+		// the first row is data, and each field is known by its index
+		first = csvHeaders
+		csvHeaders = []string{}
+		for i := range first {
+			csvHeaders = append(csvHeaders, indexKey(i))
+		}
+	}
+	if opts.expectCols > 0 && len(csvHeaders) != opts.expectCols {
+		return file, fmt.Errorf("%s: header has %v fields but %v are expected", csvPath, len(csvHeaders), opts.expectCols)
+	}
+	if opts.normHeaders {
+		seen := map[string]string{}
+		for i, header := range csvHeaders {
+			csvHeaders[i] = normalizeHeader(header)
+			if prev, ok := seen[csvHeaders[i]]; ok && csvHeaders[i] != "" {
+				return file, fmt.Errorf("headers %q and %q both normalize to %q", prev, header, csvHeaders[i])
+			}
+			seen[csvHeaders[i]] = header
+		}
+	}
+	if len(opts.wantHeader) > 0 {
+		if diff := headerDiff(opts.wantHeader, csvHeaders); diff != "" {
+			return file, fmt.Errorf("%s: header doesn't match the expected header: %s", csvPath, diff)
+		}
+	}
+	// rows are still checked against every header, but only the kept ones
+	// become record keys
+	file.headers = csvHeaders
+	if opts.trimEmpty {
+		n := len(csvHeaders)
+		for n > 0 && csvHeaders[n-1] == "" {
+			n--
+		}
+		file.headers = csvHeaders[:n]
+	}
+	healIdx := -1
+	if opts.healCol != "" {
 		for i, header := range csvHeaders {
-			record[header] = line[i]
+			if header == opts.healCol {
+				healIdx = i
+			}
+		}
+		if healIdx < 0 {
+			return file, fmt.Errorf("%s: no column %q to heal shifts in", csvPath, opts.healCol)
+		}
+	}
+	if opts.mappingRow {
+		aliases, err := read("mapping row")
+		if err == io.EOF {
+			return file, fmt.Errorf("%s: no mapping row", csvPath)
+		}
+		if err != nil {
+			return file, err
+		}
+		if len(aliases) != len(csvHeaders) {
+			return file, fmt.Errorf("mapping row has %v fields but the header has %v", len(aliases), len(csvHeaders))
+		}
+		for i, header := range file.headers {
+			// columns without an alias aren't mapped
+			if aliases[i] != "" {
+				file.mapping = append(file.mapping, column{header, aliases[i]})
+			}
 		}
-		records = append(records, record)
 	}
+	if opts.typesRow {
+		types, err := read("types row")
+		if err == io.EOF {
+			return file, fmt.Errorf("%s: no types row", csvPath)
+		}
+		if err != nil {
+			return file, err
+		}
+		if len(types) != len(csvHeaders) {
+			return file, fmt.Errorf("types row has %v fields but the header has %v", len(types), len(csvHeaders))
+		}
+		file.types = map[string]string{}
+		for i, header := range file.headers {
+			// columns without a type aren't declared
+			if types[i] == "" {
+				continue
+			}
+			if !set(columnTypeNames)[types[i]] {
+				return file, fmt.Errorf("types row: unknown type %q for column %q; expected one of %v", types[i], header, columnTypeNames)
+			}
+			file.types[header] = types[i]
+		}
+	}
+	for {
+		row := fmt.Sprintf("record %v", len(file.records))
+		line := first
+		first = nil
+		if line == nil {
+			line, err = read(row)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return file, err
+			}
+		}
+		if healIdx >= 0 && len(line) == len(csvHeaders)+1 {
+			healed := append([]string{}, line[:healIdx]...)
+			healed = append(healed, line[healIdx]+string(reader.Comma)+line[healIdx+1])
+			line = append(healed, line[healIdx+2:]...)
+			err := opts.warn("%s had an extra field; rejoined %q as %q", row, opts.healCol, line[healIdx])
+			if err != nil {
+				return file, err
+			}
+		}
+		if len(line) > len(csvHeaders) || (len(line) < len(csvHeaders) && !opts.allowRagged) {
+			return file, fmt.Errorf("%s has %v fields but the header has %v", row, len(line), len(csvHeaders))
+		}
+		record := map[string]string{}
+		for i, header := range file.headers {
+			field := ""
+			if i < len(line) {
+				field = line[i]
+			} else if opts.skipAbsent {
+				continue
+			}
+			record[header] = field
+			if opts.indexKeys {
+				record[indexKey(i)] = field
+			}
+		}
+		file.records = append(file.records, record)
+	}
+
+	return file, nil
+}
+
+// delimiters are the field delimiters --auto-delimiter chooses between, in
+// order of preference.
+var delimiters = []rune{',', '\t', ';', '|'}
+
+// sniffDelimiter picks the delimiter of the CSV at path from delimiters: the
+// one splitting its first lines into the most fields, as long as they all
+// have the same number. It falls back to a comma.
+func sniffDelimiter(path string) (rune, error) {
+	best, bestFields := ',', 1
+	for _, comma := range delimiters {
+		f, err := os.Open(path)
+		if err != nil {
+			return best, err
+		}
+		reader := csv.NewReader(f)
+		reader.Comma = comma
+		fields := 0
+		for i := 0; i < 10; i++ {
+			line, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil || (fields > 0 && len(line) != fields) {
+				fields = 0
+				break
+			}
+			fields = len(line)
+		}
+		f.Close()
+		if fields > bestFields {
+			best, bestFields = comma, fields
+		}
+	}
+	return best, nil
+}
 
-	return records, nil
+// readCSVs reads each CSV in turn as one combined file. Every file must have
+// the same headers as the first, which also gives any mapping and types rows.
+func readCSVs(paths []string, opts csvOpts) (file csvFile, err error) {
+	for i, path := range paths {
+		next, err := readCSV(path, opts)
+		if err != nil {
+			return file, err
+		}
+		if i == 0 {
+			file = next
+			continue
+		}
+		same := len(next.headers) == len(file.headers)
+		for j := 0; same && j < len(next.headers); j++ {
+			same = next.headers[j] == file.headers[j]
+		}
+		if !same {
+			return file, fmt.Errorf("%s: headers %q don't match %q of %s", path, next.headers, file.headers, paths[0])
+		}
+		file.records = append(file.records, next.records...)
+	}
+	return file, nil
 }
 
-func sqlRecords(csvRecords []record, columns []column, valTransforms []transform) (sqlRecords []record, err error) {
+// nullLiteral is the csv value that --null-literal-passthrough writes as the
+// string 'NULL'.
+const nullLiteral = `\NULL`
+
+// sqlRecords maps csv records to records of sql columns and values. With
+// ciValues, value transforms match regardless of case. A value transformed
+// to an empty string is indistinguishable from an empty csv value, so it
+// gets the same NULL, empty string or DEFAULT handling in queryOpts.value.
+// With keepNullLiteral, nullLiteral values are left for queryOpts.value
+// rather than looked up or transformed.
+func sqlRecords(csvRecords []record, columns []column, valTransforms []transform, lookups []lookup, ciValues, keepNullLiteral bool) (sqlRecords []record, err error) {
+	fold := func(v string) string {
+		if ciValues {
+			return strings.ToLower(v)
+		}
+		return v
+	}
+	// later transforms of the same value win
+	sqlVals := map[string]string{}
+	for _, val := range valTransforms {
+		sqlVals[fold(val.CSV)] = val.SQL
+	}
+
+	byCol := map[string]lookup{}
+	for _, lk := range lookups {
+		byCol[lk.Col] = lk
+	}
+
 	sqlRecords = []record{}
-	for _, csvRecord := range csvRecords {
+	for i, csvRecord := range csvRecords {
 		sqlRecord := record{}
-		for csvCol, csvVal := range csvRecord {
-			for _, col := range columns {
-				if csvCol == col.CSV {
-					v := csvVal
-					for _, val := range valTransforms {
-						if csvVal == val.CSV {
-							v = val.SQL
-						}
-					}
-					sqlRecord[col.SQL] = v
+		// iterate columns rather than the record map so that when several
+		// columns share a sql alias the last one listed always wins. A csv
+		// column can feed several sql columns, each transformed on its own.
+		for _, col := range columns {
+			csvVal, ok := csvRecord[col.CSV]
+			if !ok {
+				continue
+			}
+			if keepNullLiteral && csvVal == nullLiteral {
+				sqlRecord[col.SQL] = csvVal
+				continue
+			}
+			if lk, ok := byCol[col.SQL]; ok {
+				csvVal, err = lk.apply(csvVal)
+				if err != nil {
+					return sqlRecords, fmt.Errorf("record %d: %w", i+1, err)
 				}
 			}
+			if sqlVal, ok := sqlVals[fold(csvVal)]; ok {
+				csvVal = sqlVal
+			}
+			sqlRecord[col.SQL] = csvVal
+		}
+		for _, key := range metaKeys {
+			if v, ok := csvRecord[key]; ok {
+				sqlRecord[key] = v
+			}
 		}
 		sqlRecords = append(sqlRecords, sqlRecord)
 	}
 	return sqlRecords, nil
 }
 
-func updateQueries(updates []record, table string, pk column) (queries []string, err error) {
-	intif := func(v string) any {
-		intVal, err := strconv.ParseInt(v, 10, 64)
-		if err != nil {
-			return v
+// writeTable writes records as aligned columns under a header row.
+func writeTable(w io.Writer, records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	cols := sqlColumns(records[0])
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(cols, "\t"))
+	for _, rec := range records {
+		vals := []string{}
+		for _, col := range cols {
+			vals = append(vals, rec[col])
 		}
-		return intVal
+		fmt.Fprintln(tw, strings.Join(vals, "\t"))
 	}
+	return tw.Flush()
+}
 
-	cols := maps.Keys(updates[0])
-	sort.Strings(cols)
-	for _, upd := range updates {
-		var pkVal string
-		ub := sqlbuilder.MySQL.NewUpdateBuilder()
-		ub.Update(table)
-		assigns := []string{}
+// dedupe keeps one record, the first or last, for each distinct combination
+// of values in cols, in order of first appearance.
+func dedupe(records []record, cols []string, keepLast bool) (kept []record, collapsed int) {
+	kept = []record{}
+	index := map[string]int{}
+	for _, rec := range records {
+		vals := []string{}
 		for _, col := range cols {
-			v := upd[col]
-			switch {
-			case col == pk.SQL:
-				pkVal = v
-			case v == "":
-				assigns = append(assigns, ub.Assign(col, nil))
-			case v == "now()":
-				assigns = append(assigns, ub.Assign(col, sqlbuilder.Raw(v)))
-			default:
-				assigns = append(assigns, ub.Assign(col, intif(v)))
-			}
+			vals = append(vals, rec[col])
 		}
-		ub.Set(assigns...)
-		ub.Where(ub.Equal(pk.SQL, intif(pkVal)))
-		sql, args := ub.Build()
-		query, err := sqlbuilder.MySQL.Interpolate(sql, args)
-		if err != nil {
-			return queries, err
+		key := fmt.Sprintf("%q", vals)
+		if i, ok := index[key]; ok {
+			collapsed++
+			if keepLast {
+				kept[i] = rec
+			}
+			continue
 		}
-		queries = append(queries, query)
+		index[key] = len(kept)
+		kept = append(kept, rec)
 	}
-	return queries, nil
+	return kept, collapsed
 }
 
-type updateCmd struct {
-	args    args
-	verbose bool
+// hashRecords sets col in each record to the sha256 hex of the values of
+// cols, sorted by column so it's the same across runs.
+func hashRecords(records []record, col string, cols []column) {
+	names := []string{}
+	for _, c := range cols {
+		if c.SQL != col {
+			names = append(names, c.SQL)
+		}
+	}
+	sort.Strings(names)
+	for _, rec := range records {
+		h := sha256.New()
+		for i, name := range names {
+			// several columns can share a sql name
+			if i > 0 && name == names[i-1] {
+				continue
+			}
+			fmt.Fprintf(h, "%q=%q;", name, rec[name])
+		}
+		rec[col] = hex.EncodeToString(h.Sum(nil))
+	}
 }
 
-func (cmd *updateCmd) logV(format string, a ...any) {
-	if !cmd.verbose {
-		return
+func withPK(records []record, pk column) (kept []record, skipped int) {
+	kept = []record{}
+	for _, rec := range records {
+		if rec[pk.SQL] == "" {
+			skipped++
+			continue
+		}
+		kept = append(kept, rec)
 	}
-	fmt.Printf(format, a...)
+	return kept, skipped
 }
 
-func (cmd *updateCmd) debug(msg string, v any) {
-	if !cmd.verbose {
-		return
+func intif(v string) any {
+	intVal, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		if n, ok := sciNumber(v); ok {
+			return n
+		}
+		return v
 	}
-	fmt.Printf("\n\033[1m%s:\033[0m %# v\n", msg, pretty.Formatter(v))
+	return intVal
 }
 
-func (cmd *updateCmd) run() (err error) {
-	cmd.debug("args", cmd.args)
+var sciNotation = regexp.MustCompile(`^[+-]?(\d+(\.\d*)?|\.\d+)[eE][+-]?\d+$`)
 
-	pk, err := newColumn(cmd.args.CsvPK)
-	if err != nil {
-		return err
+// sciNumber parses a number in scientific notation, as spreadsheets export
+// large values, e.g. 1.23E+10. Whole numbers that fit are int64s and others
+// float64s, so either is written as a numeric literal.
+func sciNumber(v string) (any, bool) {
+	if !sciNotation.MatchString(v) {
+		return nil, false
 	}
-	cmd.debug("pk column", pk)
-
-	cols, err := columns(cmd.args.Columns)
+	f, err := strconv.ParseFloat(v, 64)
 	if err != nil {
-		return err
+		return nil, false
 	}
-	cmd.debug("columns", cols)
-
-	valTransforms, err := transforms(cmd.args.ValueTransforms)
-	if err != nil {
-		return err
+	if f == math.Trunc(f) && math.Abs(f) < 1<<63 {
+		return int64(f), true
 	}
-	cmd.debug("value transforms", valTransforms)
+	return f, true
+}
 
-	csv, err := csvRecords(cmd.args.CSVPath)
-	if err != nil {
-		return err
+// pkTypes counts the non-empty pk values that do and don't parse as integers.
+// A mix of both usually means the wrong column was chosen as the pk.
+func pkTypes(records []record, pk column) (ints, others int) {
+	for _, rec := range records {
+		v := rec[pk.SQL]
+		switch intif(v).(type) {
+		case int64:
+			ints++
+		default:
+			if v != "" {
+				others++
+			}
+		}
 	}
-	cmd.debug("csv", head(csv, 5))
-	cmd.logV("...\n(%v records)\n", len(csv))
+	return ints, others
+}
 
-	cols = append(cols, pk)
-	updates, err := sqlRecords(csv, cols, valTransforms)
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// pkValue returns the sql value matching the pk value v in a WHERE clause,
+// per pkType, or inferred like other values if it's empty.
+func (opts queryOpts) pkValue(v string) (any, error) {
+	switch opts.pkType {
+	case "int":
+		pkVal, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("pk %q is not an int", v)
+		}
+		return pkVal, nil
+	case "string":
+		return v, nil
+	case "uuid":
+		if !uuidPattern.MatchString(v) {
+			return nil, fmt.Errorf("pk %q is not a uuid", v)
+		}
+		if opts.flavor != sqlbuilder.PostgreSQL {
+			return v, nil
+		}
+		lit, err := literal(opts.flavor, v)
+		if err != nil {
+			return nil, err
+		}
+		return sqlbuilder.Raw(lit + "::uuid"), nil
+	default:
+		return intif(v), nil
+	}
+}
+
+// pkCond returns the condition matching rows with any of the pk values.
+// With nullPK an empty pk matches NULL.
+func (opts queryOpts) pkCond(cond *sqlbuilder.Cond, pk column, pkVals []string) (string, error) {
+	vals := []any{}
+	matchNull := false
+	for _, v := range pkVals {
+		if v == "" && opts.nullPK {
+			matchNull = true
+			continue
+		}
+		val, err := opts.pkValue(v)
+		if err != nil {
+			return "", err
+		}
+		vals = append(vals, val)
+	}
+	exprs := []string{}
+	switch len(vals) {
+	case 0:
+	case 1:
+		exprs = append(exprs, cond.Equal(ident(opts.flavor, pk.SQL), vals[0]))
+	default:
+		exprs = append(exprs, cond.In(ident(opts.flavor, pk.SQL), vals...))
+	}
+	if matchNull {
+		exprs = append(exprs, cond.IsNull(ident(opts.flavor, pk.SQL)))
+	}
+	if len(exprs) == 1 {
+		return exprs[0], nil
+	}
+	return cond.Or(exprs...), nil
+}
+
+var hexLiteral = regexp.MustCompile(`^0x[0-9a-fA-F]+$`)
+
+var functionCall = regexp.MustCompile(`(?s)^[A-Za-z_][A-Za-z0-9_.]*\s*\(.*\)$`)
+
+func set(names []string) map[string]bool {
+	s := map[string]bool{}
+	for _, name := range names {
+		s[name] = true
+	}
+	return s
+}
+
+// queryOpts controls how records are turned into statements.
+type queryOpts struct {
+	flavor     sqlbuilder.Flavor
+	pkType     string
+	nullPK     bool
+	rawAssigns []assignment
+	rawCols    map[string]bool
+	hexCols    map[string]bool
+	funcCols   map[string]bool
+	jsonCols   map[string]bool
+	arrayCols  map[string]bool
+	// emptyStringCols get '' rather than NULL for empty values
+	emptyStringCols map[string]bool
+	// defaultCols get DEFAULT rather than NULL for empty values
+	defaultCols map[string]bool
+	// types declares the type of sql columns; other columns are inferred
+	types        map[string]string
+	lenientTypes bool
+	// noInterpolate leaves placeholders in the sql and lists the args in a
+	// trailing comment
+	noInterpolate bool
+	// groupIdentical updates records with identical values in one
+	// statement matching all their pks
+	groupIdentical bool
+	// parallelism is the number of goroutines building statements
+	parallelism int
+	// batchSize is the number of rows per insert, written as VALUES rows or
+	// as SELECTs joined with UNION ALL per batchStyle
+	batchSize  int
+	batchStyle string
+	// ciValues matches now() regardless of case
+	ciValues bool
+	// numberLocale, when set, normalizes numbers written in a locale
+	numberLocale *numberLocale
+	// nullLiteral writes \NULL values as the string 'NULL'
+	nullLiteral bool
+	// stripCurrency removes currency symbols before numberLocale
+	stripCurrency bool
+	// autoDate rewrites values matching dateLayouts in ISO 8601
+	autoDate bool
+	// profile, when set, accumulates interpolation time for --profile
+	profile *profile
+	// maxStatementBytes splits a batch before its insert grows past this
+	// many bytes; 0 means no limit
+	maxStatementBytes int
+	// guardCols must also still have their base values for a row to be
+	// updated
+	guardCols []column
+	// emitNoops keeps updates with nothing to SET as comments rather than
+	// dropping them
+	emitNoops bool
+	// limitOne appends LIMIT 1 to each update, which mysql allows
+	limitOne bool
+	// columnOrder lists sql columns to SET first, in order, before the
+	// rest alphabetically
+	columnOrder []string
+	// matchCols, if any, replace the pk in the WHERE of updates with AND-ed
+	// equalities and are never SET
+	matchCols []column
+	// nullMatch matches NULL for empty matchCols values, which otherwise
+	// are an error
+	nullMatch bool
+	base      map[string]record
+	warn      func(format string, a ...any) error
+}
+
+// value returns the sql value to assign to col for the sql record value v.
+// The first matching rule wins:
+//
+//   - with nullLiteral, a \NULL value is the string 'NULL'
+//   - empty values are empty strings in emptyStringCols, DEFAULT in
+//     defaultCols and NULL otherwise
+//   - now(), in any case with ciValues, and any value in rawCols, is passed
+//     through raw
+//   - hexCols values matching 0x[0-9a-fA-F]+ are raw hex literals
+//   - funcCols values that look like name(...) are raw function calls
+//   - jsonCols and arrayCols values are postgres jsonb and arrays
+//   - before coercion, currency symbols are stripped with stripCurrency,
+//     numbers normalized from numberLocale, if set, and dates rewritten in
+//     ISO 8601 with autoDate
+//   - values of typed columns are coerced to the declared type
+//   - anything else is an integer if it parses as one, a number if it's in
+//     scientific notation, or else a string
+func (opts queryOpts) value(col, v string) (any, error) {
+	switch {
+	case opts.nullLiteral && v == nullLiteral:
+		return "NULL", nil
+	case v == "" && opts.emptyStringCols[col]:
+		return "", nil
+	case v == "" && opts.defaultCols[col]:
+		return sqlbuilder.Raw("DEFAULT"), nil
+	case v == "":
+		return nil, nil
+	case v == "now()", opts.ciValues && strings.EqualFold(v, "now()"), opts.rawCols[col]:
+		return sqlbuilder.Raw(v), nil
+	case opts.hexCols[col]:
+		if hexLiteral.MatchString(v) {
+			return sqlbuilder.Raw(v), nil
+		}
+		if err := opts.warn("column %q value %q is not a hex literal", col, v); err != nil {
+			return nil, err
+		}
+	case opts.funcCols[col]:
+		if functionCall.MatchString(v) {
+			return sqlbuilder.Raw(v), nil
+		}
+		if err := opts.warn("column %q value %q is not a function call", col, v); err != nil {
+			return nil, err
+		}
+	case opts.jsonCols[col]:
+		return jsonbValue(v)
+	case opts.arrayCols[col]:
+		return arrayValue(v)
+	}
+	loc := opts.numberLocale
+	if opts.stripCurrency {
+		// amounts without a --number-locale are read as en, so their
+		// thousands separators go too
+		amountLoc := numberLocales["en"]
+		if loc != nil {
+			amountLoc = *loc
+		}
+		if amount, ok := stripCurrency(v, amountLoc); ok {
+			v, loc = amount, nil
+		}
+	}
+	if loc != nil {
+		v = loc.normalize(v)
+	}
+	if opts.autoDate {
+		v = autoDate(v)
+	}
+	switch {
+	case opts.types[col] != "":
+		val, err := coerce(v, opts.types[col])
+		if err == nil {
+			return val, nil
+		}
+		if !opts.lenientTypes {
+			return nil, fmt.Errorf("column %q value %q is not a valid %s", col, v, opts.types[col])
+		}
+		if err := opts.warn("column %q value %q is not a valid %s", col, v, opts.types[col]); err != nil {
+			return nil, err
+		}
+	}
+	return intif(v), nil
+}
+
+// statement is a generated sql statement, rendered with its terminator and an
+// optional trailing comment.
+type statement struct {
+	SQL     string
+	Comment string
+	// Fragment marks sql that isn't a whole statement, like a values tuple,
+	// which is rendered without a terminator.
+	Fragment bool
+	// PKs are the pk values of the records the statement was built from,
+	// Rows their CSV rows, for --annotate, and Notes their --comment-column
+	// values
+	PKs   []string
+	Rows  []string
+	Notes []string
+}
+
+// from records the pks, CSV rows and notes of the records stmt was built
+// from.
+func (stmt *statement) from(recs []record, pk column) {
+	stmt.PKs, stmt.Rows, stmt.Notes = nil, nil, nil
+	for _, rec := range recs {
+		stmt.PKs = append(stmt.PKs, rec[pk.SQL])
+		if row, ok := rec[rowKey]; ok {
+			stmt.Rows = append(stmt.Rows, row)
+		}
+		if note, ok := rec[noteKey]; ok {
+			stmt.Notes = append(stmt.Notes, note)
+		}
+	}
+}
+
+func (stmt statement) String() string {
+	if stmt.SQL == "" {
+		return "-- " + stmt.Comment
+	}
+	sql := stmt.SQL
+	if !stmt.Fragment {
+		sql += ";"
+	}
+	if stmt.Comment == "" {
+		return sql
+	}
+	return sql + " -- " + stmt.Comment
+}
+
+// argsComment renders placeholder args as sql literals, for reference
+// alongside a statement that wasn't interpolated.
+func argsComment(flavor sqlbuilder.Flavor, args []any) (string, error) {
+	lits := []string{}
+	for _, arg := range args {
+		lit, err := literal(flavor, arg)
+		if err != nil {
+			return "", err
+		}
+		lits = append(lits, lit)
+	}
+	return "args: [" + strings.Join(lits, ", ") + "]", nil
+}
+
+// pkGroup is a record to update along with the pks of every record it
+// stands for.
+type pkGroup struct {
+	rec    record
+	pkVals []string
+	// recs are all the records of the group, rec first
+	recs []record
+}
+
+// pkGroups pairs each record with its own pk or, when grouping, collapses
+// records whose non-pk values in cols are identical into one group, in order
+// of first appearance.
+func pkGroups(updates []record, cols []string, pk column, grouping bool) []pkGroup {
+	groups := []pkGroup{}
+	index := map[string]int{}
+	for _, upd := range updates {
+		if grouping {
+			// pair each value with its column, since records may not all
+			// have the same columns
+			vals := []string{}
+			for _, col := range cols {
+				if v, ok := upd[col]; ok && col != pk.SQL {
+					vals = append(vals, col, v)
+				}
+			}
+			key := fmt.Sprintf("%q", vals)
+			if i, ok := index[key]; ok {
+				groups[i].pkVals = append(groups[i].pkVals, upd[pk.SQL])
+				groups[i].recs = append(groups[i].recs, upd)
+				continue
+			}
+			index[key] = len(groups)
+		}
+		groups = append(groups, pkGroup{upd, []string{upd[pk.SQL]}, []record{upd}})
+	}
+	return groups
+}
+
+// statement interpolates a built statement's args, or lists them in a
+// trailing comment with noInterpolate.
+func (opts queryOpts) statement(sql string, args []any) (statement, error) {
+	if opts.noInterpolate {
+		comment, err := argsComment(opts.flavor, args)
+		return statement{SQL: sql, Comment: comment}, err
+	}
+	start := time.Now()
+	query, err := opts.flavor.Interpolate(sql, args)
+	opts.profile.interpolating(start)
+	return statement{SQL: query}, err
+}
+
+// parallel calls fn for each index in [0, n), in batches spread across up to
+// workers goroutines.
+func parallel(n, workers int, fn func(i int)) {
+	const batchSize = 256
+	if workers <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	batches := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range batches {
+				for i := start; i < start+batchSize && i < n; i++ {
+					fn(i)
+				}
+			}
+		}()
+	}
+	for start := 0; start < n; start += batchSize {
+		batches <- start
+	}
+	close(batches)
+	wg.Wait()
+}
+
+// orderColumns moves the columns named in order to the front of cols, in
+// that order, leaving the rest in their existing order after them. Names
+// that aren't in cols are ignored.
+func orderColumns(cols []string, order []string) []string {
+	if len(order) == 0 {
+		return cols
+	}
+	has := set(cols)
+	ordered := []string{}
+	listed := map[string]bool{}
+	for _, col := range order {
+		if has[col] && !listed[col] {
+			ordered = append(ordered, col)
+			listed[col] = true
+		}
+	}
+	for _, col := range cols {
+		if !listed[col] {
+			ordered = append(ordered, col)
+		}
+	}
+	return ordered
+}
+
+func updateQueries(updates []record, table string, pk column, opts queryOpts) (queries []statement, err error) {
+	if len(updates) == 0 {
+		return queries, nil
+	}
+	raw := map[string]bool{}
+	for _, asg := range opts.rawAssigns {
+		raw[asg.Col] = true
+	}
+
+	// records may not all have the same columns, so take every record's,
+	// and each update sets just its own
+	all := map[string]bool{}
+	for _, upd := range updates {
+		for col := range upd {
+			if !isMetaKey(col) {
+				all[col] = true
+			}
+		}
+	}
+	cols := maps.Keys(all)
+	sort.Strings(cols)
+	cols = orderColumns(cols, opts.columnOrder)
+	groups := pkGroups(updates, cols, pk, opts.groupIdentical)
+	// each worker writes only its own indexes, preserving the output order
+	queries = make([]statement, len(groups))
+	errs := make([]error, len(groups))
+	parallel(len(groups), opts.parallelism, func(i int) {
+		queries[i], errs[i] = opts.updateQuery(groups[i], cols, table, pk, raw)
+	})
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !opts.emitNoops {
+		kept := []statement{}
+		for _, stmt := range queries {
+			if stmt.SQL != "" {
+				kept = append(kept, stmt)
+			}
+		}
+		queries = kept
+	}
+	return queries, nil
+}
+
+func (opts queryOpts) updateQuery(group pkGroup, cols []string, table string, pk column, raw map[string]bool) (stmt statement, err error) {
+	ub := opts.flavor.NewUpdateBuilder()
+	ub.Update(table)
+	assigns := []string{}
+	match := map[string]bool{}
+	for _, col := range opts.matchCols {
+		match[col.SQL] = true
+	}
+	for _, col := range cols {
+		v, ok := group.rec[col]
+		switch {
+		case !ok, col == pk.SQL, match[col]:
+		case raw[col]:
+			// overridden by --assign-raw below
+		default:
+			val, err := opts.value(col, v)
+			if err != nil {
+				return stmt, err
+			}
+			assigns = append(assigns, ub.Assign(ident(opts.flavor, col), val))
+		}
+	}
+	for _, asg := range opts.rawAssigns {
+		assigns = append(assigns, ub.Assign(ident(opts.flavor, asg.Col), sqlbuilder.Raw(asg.Expr)))
+	}
+	if len(assigns) == 0 {
+		// an empty SET isn't valid sql, so leave a comment at most
+		stmt = statement{Comment: fmt.Sprintf("noop for pk=%s", strings.Join(group.pkVals, ","))}
+		stmt.from(group.recs, pk)
+		return stmt, nil
+	}
+	ub.Set(assigns...)
+	if len(opts.matchCols) > 0 {
+		for _, col := range opts.matchCols {
+			val, err := opts.value(col.SQL, group.rec[col.SQL])
+			if err != nil {
+				return stmt, err
+			}
+			if val == nil && !opts.nullMatch {
+				return stmt, fmt.Errorf("pk=%s has an empty --match-columns value for %q; give --null-match to match NULL", strings.Join(group.pkVals, ","), col.SQL)
+			}
+			if val == nil {
+				ub.Where(ub.IsNull(ident(opts.flavor, col.SQL)))
+			} else {
+				ub.Where(ub.Equal(ident(opts.flavor, col.SQL), val))
+			}
+		}
+	} else {
+		pkCond, err := opts.pkCond(&ub.Cond, pk, group.pkVals)
+		if err != nil {
+			return stmt, err
+		}
+		ub.Where(pkCond)
+	}
+	for _, col := range opts.guardCols {
+		val, err := opts.value(col.SQL, opts.base[group.pkVals[0]][col.SQL])
+		if err != nil {
+			return stmt, err
+		}
+		if val == nil {
+			ub.Where(ub.IsNull(ident(opts.flavor, col.SQL)))
+		} else {
+			ub.Where(ub.Equal(ident(opts.flavor, col.SQL), val))
+		}
+	}
+	if opts.limitOne {
+		ub.Limit(1)
+	}
+	stmt, err = opts.statement(ub.Build())
+	stmt.from(group.recs, pk)
+	return stmt, err
+}
+
+type updateCmd struct {
+	args    args
+	verbose bool
+	color   bool
+	// flavor is the output dialect, set once run has parsed it
+	flavor sqlbuilder.Flavor
+}
+
+// confirm asks on stderr whether to go ahead, reading the answer from stdin.
+func confirm(prompt string) (bool, error) {
+	fmt.Fprintf(os.Stderr, "%s [y/N] ", prompt)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes", nil
+}
+
+// confirm asks whether to go ahead, returning an error if not. --yes skips
+// the prompt, and without a terminal to ask on the answer is no.
+func (cmd *updateCmd) confirm(prompt string) error {
+	if cmd.args.Yes {
+		return nil
+	}
+	if !isTerminal(os.Stdin) {
+		return fmt.Errorf("aborted: can't ask %q without a terminal on stdin; pass --yes to go ahead", prompt)
+	}
+	ok, err := confirm(prompt)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("aborted")
+	}
+	return nil
+}
+
+func (cmd *updateCmd) logV(format string, a ...any) {
+	if !cmd.verbose {
+		return
+	}
+	fmt.Fprintf(os.Stderr, format, a...)
+}
+
+// warn logs a warning to stderr, or returns it as an error with --strict.
+// Unlike progress, warnings are logged without --verbose.
+func (cmd *updateCmd) warn(format string, a ...any) error {
+	if cmd.args.Strict {
+		return fmt.Errorf(format, a...)
+	}
+	fmt.Fprintf(os.Stderr, "warning: "+format+"\n", a...)
+	return nil
+}
+
+func (cmd *updateCmd) debug(msg string, v any) {
+	if !cmd.verbose {
+		return
+	}
+	format := "\n%s: %# v\n"
+	if cmd.color {
+		format = "\n\033[1m%s:\033[0m %# v\n"
+	}
+	fmt.Fprintf(os.Stderr, format, msg, pretty.Formatter(v))
+}
+
+// writeScript writes statements as the output sql, one per line. A buffered
+// w is flushed every flushEvery statements.
+func (cmd *updateCmd) writeScript(w io.Writer, stmts []statement, flushEvery int) error {
+	// savepoints need a transaction, which --script already opens, as it's
+	// mysql only
+	begin := ""
+	inTx := cmd.args.Savepoints || cmd.args.SafeWrap
+	switch {
+	case cmd.args.Script:
+		begin = "SET autocommit=0;"
+	case inTx && cmd.flavor == sqlbuilder.MySQL:
+		begin = "START TRANSACTION;"
+	case inTx:
+		begin = "BEGIN;"
+	}
+	if cmd.args.SQLMode != "" {
+		mode, err := literal(cmd.flavor, cmd.args.SQLMode)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "SET SESSION sql_mode=%s;\n", mode); err != nil {
+			return err
+		}
+	}
+	if begin != "" {
+		if _, err := fmt.Fprintln(w, begin); err != nil {
+			return err
+		}
+	}
+	last := -1
+	if cmd.args.NoFinalSemicolon {
+		for i, stmt := range stmts {
+			if stmt.SQL != "" {
+				last = i
+			}
+		}
+	}
+	for i, stmt := range stmts {
+		if i == last {
+			// written like a fragment, without its ;
+			stmt.Fragment = true
+		}
+		if cmd.args.Savepoints {
+			if _, err := fmt.Fprintf(w, "SAVEPOINT sp%d;\n", i+1); err != nil {
+				return err
+			}
+		}
+		if cmd.args.Annotate && len(stmt.Rows) > 0 {
+			if _, err := fmt.Fprintln(w, cmd.annotation(stmt)); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w, stmt); err != nil {
+			return err
+		}
+		if cmd.args.Savepoints {
+			if _, err := fmt.Fprintf(w, "RELEASE SAVEPOINT sp%d;\n", i+1); err != nil {
+				return err
+			}
+		}
+		if bw, ok := w.(*bufio.Writer); ok && flushEvery > 0 && (i+1)%flushEvery == 0 {
+			if err := bw.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+	end := "COMMIT;"
+	if cmd.args.SafeWrap {
+		// the reader has to choose to commit
+		end = "-- COMMIT; -- uncomment to apply\nROLLBACK;"
+	}
+	if begin != "" {
+		if _, err := fmt.Fprintln(w, end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// noteComment adds the --comment-column notes of stmt to its comment, with
+// newlines escaped so that the comment stays on one line.
+func noteComment(stmt statement) string {
+	comments := []string{}
+	if stmt.Comment != "" {
+		comments = append(comments, stmt.Comment)
+	}
+	for _, note := range stmt.Notes {
+		note = strings.NewReplacer("\r\n", `\n`, "\n", `\n`, "\r", `\n`).Replace(note)
+		comments = append(comments, note)
+	}
+	return strings.Join(comments, "; ")
+}
+
+// annotation is a comment naming the source rows and pks of stmt.
+func (cmd *updateCmd) annotation(stmt statement) string {
+	label := "row"
+	if len(stmt.Rows) != 1 {
+		label = "rows"
+	}
+	return fmt.Sprintf("-- %s %s pk=%s", label, strings.Join(stmt.Rows, ","), strings.Join(stmt.PKs, ","))
+}
+
+// script renders statements as the output sql.
+func (cmd *updateCmd) script(stmts []statement) string {
+	var b strings.Builder
+	// writing to a strings.Builder can't fail
+	_ = cmd.writeScript(&b, stmts, 0)
+	return b.String()
+}
+
+func (cmd *updateCmd) run() (err error) {
+	if cmd.args.CheckDBEnv != "" {
+		if cmd.args.CheckDB != "" {
+			return fmt.Errorf("give either --check-db or --check-db-env")
+		}
+		cmd.args.CheckDB = os.Getenv(cmd.args.CheckDBEnv)
+		if cmd.args.CheckDB == "" {
+			return fmt.Errorf("--check-db-env %s is unset or empty", cmd.args.CheckDBEnv)
+		}
+	}
+	// the dsn may hold a password, so it's never logged as given
+	logged := cmd.args
+	logged.CheckDB = maskDSN(logged.CheckDB)
+	cmd.debug("args", logged)
+	var prof *profile
+	if cmd.args.Profile {
+		prof = newProfile()
+		defer prof.write(os.Stderr)
+	}
+	if (cmd.args.CSVPath == "") == (cmd.args.InputGlob == "") {
+		return fmt.Errorf("give either a CSV or --input-glob")
+	}
+	if cmd.args.Migration != "" && cmd.args.Out == "" {
+		return fmt.Errorf("--migration requires --out")
+	}
+	if cmd.args.OutputPerTable && (cmd.args.Out == "" || cmd.args.Migration != "") {
+		return fmt.Errorf("--output-per-table requires --out and can't be used with --migration")
+	}
+	if cmd.args.PartitionBy != "" && (cmd.args.Out == "" || cmd.args.Migration != "" || cmd.args.OutputPerTable) {
+		return fmt.Errorf("--partition-by requires --out and can't be used with --migration or --output-per-table")
+	}
+	if cmd.args.Manifest != "" && cmd.args.Migration == "" && cmd.args.DownOut == "" && !cmd.args.OutputPerTable && cmd.args.PartitionBy == "" {
+		return fmt.Errorf("--manifest requires output files from --migration, --down-out, --output-per-table or --partition-by")
+	}
+	switch cmd.args.Mode {
+	case "update":
+	case "insert", "insert-ignore", "create-table", "values", "update-case", "copy", "load-data":
+		if cmd.args.Base != "" || cmd.args.GroupIdentical {
+			return fmt.Errorf("--base, --guard-column and --group-identical only apply to --mode update")
+		}
+	default:
+		return fmt.Errorf("unknown --mode %q; expected update, update-case, insert, insert-ignore, create-table, values, copy or load-data", cmd.args.Mode)
+	}
+	bulk := cmd.args.Mode == "copy" || cmd.args.Mode == "load-data"
+	if bulk && (cmd.args.VerifySQL || cmd.args.ExplainSQL || cmd.args.CheckDB != "" || cmd.args.NoInterpolate || len(cmd.args.AssignRaw) > 0) {
+		return fmt.Errorf("--mode %s writes csv data rather than sql values, so can't be used with --verify-sql, --explain-sql, --check-db, --no-interpolate or --assign-raw", cmd.args.Mode)
+	}
+	if cmd.args.CommentColumn != "" && (cmd.args.Mode == "copy" || cmd.args.Mode == "load-data") {
+		return fmt.Errorf("--comment-column can't be used with --mode %s, whose data can't carry comments", cmd.args.Mode)
+	}
+	if cmd.args.SkipAbsent && (!cmd.args.AllowRagged || cmd.args.Mode != "update" || cmd.args.Template != "") {
+		return fmt.Errorf("--skip-absent requires --allow-ragged and --mode update without --template")
+	}
+	if cmd.args.PKGenerate != nil {
+		switch cmd.args.Mode {
+		case "insert", "insert-ignore", "values", "copy", "load-data":
+		default:
+			return fmt.Errorf("--pk-generate only applies to --mode insert, insert-ignore, values, copy or load-data")
+		}
+	}
+	if cmd.args.Mode == "update-case" && cmd.args.NullPK {
+		return fmt.Errorf("--null-pk can't be used with --mode update-case, since CASE pk WHEN never matches NULL")
+	}
+	if cmd.args.Mode == "update-case" && len(cmd.args.DefaultColumns) > 0 {
+		return fmt.Errorf("--default-column can't be used with --mode update-case, since DEFAULT isn't allowed in a CASE")
+	}
+	if cmd.args.NoFinalSemicolon && (cmd.args.Script || cmd.args.SafeWrap || cmd.args.Savepoints) {
+		return fmt.Errorf("--no-final-semicolon can't be used with --script, --safe-wrap or --savepoints, which end the output with their own statement")
+	}
+	if cmd.args.Mode == "values" && (cmd.args.Script || cmd.args.SafeWrap || cmd.args.Savepoints || cmd.args.SQLMode != "" || cmd.args.VerifySQL || cmd.args.CheckDB != "" || cmd.args.Migration != "") {
+		return fmt.Errorf("--mode values writes tuples rather than statements, so can't be used with --script, --safe-wrap, --savepoints, --sql-mode, --verify-sql, --check-db or --migration")
+	}
+	if cmd.args.Template != "" && cmd.args.Mode != "update" {
+		return fmt.Errorf("--template replaces the statements of --mode, so can't be used with it")
+	}
+	if cmd.args.Template != "" && (cmd.args.VerifySQL || cmd.args.ExplainSQL) {
+		return fmt.Errorf("--template output isn't checked, so can't be used with --verify-sql or --explain-sql")
+	}
+	if cmd.args.ExplainSQL && (cmd.args.Mode == "values" || cmd.args.Mode == "create-table") {
+		return fmt.Errorf("--explain-sql can't be used with --mode %s", cmd.args.Mode)
+	}
+	if cmd.args.CheckDB != "" && cmd.args.NoInterpolate {
+		return fmt.Errorf("--check-db runs the interpolated statements, so can't be used with --no-interpolate")
+	}
+	if cmd.args.BatchStyle != "values" && cmd.args.BatchStyle != "union" {
+		return fmt.Errorf("--batch-style must be values or union; got %q", cmd.args.BatchStyle)
+	}
+	if cmd.args.BatchStyle == "union" && len(cmd.args.DefaultColumns) > 0 {
+		// DEFAULT is only allowed in VALUES, not in a SELECT list
+		return fmt.Errorf("--default-column can't be used with --batch-style union")
+	}
+	if len(cmd.args.MatchColumns) > 0 && (cmd.args.Mode != "update" || cmd.args.GroupIdentical) {
+		return fmt.Errorf("--match-columns only applies to --mode update without --group-identical")
+	}
+	if cmd.args.NullMatch && len(cmd.args.MatchColumns) == 0 {
+		return fmt.Errorf("--null-match only applies with --match-columns")
+	}
+	if cmd.args.UpdateLimit1 && (cmd.args.Mode != "update" || cmd.args.GroupIdentical) {
+		return fmt.Errorf("--update-limit-1 only applies to --mode update without --group-identical")
+	}
+	if cmd.args.Keep != "first" && cmd.args.Keep != "last" {
+		return fmt.Errorf("--keep must be first or last; got %q", cmd.args.Keep)
+	}
+	if cmd.args.DownOut != "" && cmd.args.Base == "" {
+		return fmt.Errorf("--down-out requires --base")
+	}
+	if len(cmd.args.GuardColumns) > 0 {
+		if cmd.args.Base == "" {
+			return fmt.Errorf("--guard-column requires --base")
+		}
+		if cmd.args.GroupIdentical {
+			return fmt.Errorf("--guard-column can't be used with --group-identical")
+		}
+	}
+
+	// index columns are also split on commas, so a comma separator would be
+	// ambiguous
+	if cmd.args.MapSep == "" || strings.Contains(cmd.args.MapSep, ",") {
+		return fmt.Errorf("--map-sep must be non-empty and can't contain a comma; got %q", cmd.args.MapSep)
+	}
+
+	// flavor is the dialect every statement is built, interpolated, verified
+	// and checked in
+	outputDialect := cmd.args.OutputDialect
+	if outputDialect == "" {
+		outputDialect = cmd.args.Dialect
+	}
+	if _, err := dialectFlavor(cmd.args.Dialect); err != nil {
+		return err
+	}
+	flavor, err := dialectFlavor(outputDialect)
+	if err != nil {
+		return err
+	}
+	cmd.debug("output dialect", outputDialect)
+	cmd.flavor = flavor
+	if flavor != sqlbuilder.PostgreSQL && (len(cmd.args.JSONColumns) > 0 || len(cmd.args.ArrayColumns) > 0) {
+		return fmt.Errorf("--json-column and --array-column require postgresql output")
+	}
+	if flavor != sqlbuilder.MySQL && cmd.args.UpdateLimit1 {
+		return fmt.Errorf("--update-limit-1 requires mysql output")
+	}
+	if flavor != sqlbuilder.MySQL && cmd.args.SQLMode != "" {
+		return fmt.Errorf("--sql-mode requires mysql output")
+	}
+	if flavor != sqlbuilder.MySQL && cmd.args.Script {
+		return fmt.Errorf("--script requires mysql output")
+	}
+	if flavor == sqlbuilder.MySQL && cmd.args.CheckDB != "" && cmd.args.Mode == "create-table" {
+		// mysql commits DDL implicitly, so the rollback wouldn't undo it
+		return fmt.Errorf("--check-db can't check --mode create-table on mysql, which commits DDL")
+	}
+	if flavor != sqlbuilder.PostgreSQL && cmd.args.Mode == "copy" {
+		return fmt.Errorf("--mode copy requires postgresql output")
+	}
+	if flavor != sqlbuilder.MySQL && cmd.args.Mode == "load-data" {
+		return fmt.Errorf("--mode load-data requires mysql output")
+	}
+	loadDataDir := cmd.args.LoadDataDir
+	if loadDataDir == "" {
+		loadDataDir = cmd.args.Out
+	}
+	if cmd.args.Mode == "load-data" && loadDataDir == "" {
+		return fmt.Errorf("--mode load-data requires --load-data-dir or --out to write its csv files to")
+	}
+
+	pk, err := newColumn(cmd.args.CsvPK, cmd.args.MapSep)
+	if err != nil {
+		return err
+	}
+	cmd.debug("pk column", pk)
+	if cmd.args.NoHeader && (len(cmd.args.ColumnsByIndex) == 0 || !isIndexPK(pk)) {
+		return fmt.Errorf("--no-header needs --columns-by-index and a --pk given by index, like \"#0->id\"")
+	}
+	if cmd.args.NoHeader && (cmd.args.MappingRow || cmd.args.TypesRow || cmd.args.ExpectHeader != "") {
+		return fmt.Errorf("--no-header can't be used with --mapping-row, --types-row or --expect-header")
+	}
+	switch cmd.args.PKType {
+	case "", "int", "string", "uuid":
+	default:
+		return fmt.Errorf("unknown --pk-type %q; expected int, string or uuid", cmd.args.PKType)
+	}
+
+	cols, err := columns(cmd.args.Columns, cmd.args.MapSep)
+	if err != nil {
+		return err
+	}
+	cmd.debug("columns", cols)
+
+	valTransforms, err := transforms(cmd.args.ValueTransforms, cmd.args.MapSep)
+	if err != nil {
+		return err
+	}
+	// NA values go first, so an explicit transform of the same value wins
+	valTransforms = append(naTransforms(cmd.args.NAValues), valTransforms...)
+	cmd.debug("value transforms", valTransforms)
+
+	lks, err := lookups(cmd.args.Lookups, cmd.args.LookupStrict)
+	if err != nil {
+		return err
+	}
+
+	matchCols := []column{}
+	for _, s := range cmd.args.MatchColumns {
+		cs, err := columns(strings.Split(s, ","), cmd.args.MapSep)
+		if err != nil {
+			return err
+		}
+		matchCols = append(matchCols, cs...)
+	}
+	cmd.debug("match columns", matchCols)
+
+	columnOrder := []string{}
+	for _, s := range cmd.args.ColumnOrder {
+		columnOrder = append(columnOrder, strings.Split(s, ",")...)
+	}
+
+	guardCols, err := columns(cmd.args.GuardColumns, cmd.args.MapSep)
+	if err != nil {
+		return err
+	}
+	cmd.debug("guard columns", guardCols)
+
+	types, err := columnTypes(cmd.args.Types)
+	if err != nil {
+		return err
+	}
+	cmd.debug("column types", types)
+
+	var numLocale *numberLocale
+	if cmd.args.NumberLocale != "" {
+		loc, ok := numberLocales[cmd.args.NumberLocale]
+		if !ok {
+			return fmt.Errorf("unknown --number-locale %q; expected en, de, fr or ch", cmd.args.NumberLocale)
+		}
+		numLocale = &loc
+	}
+
+	rawAssigns, err := assignments(cmd.args.AssignRaw)
+	if err != nil {
+		return err
+	}
+	cmd.debug("raw assignments", rawAssigns)
+
+	wantHeader := []string{}
+	if cmd.args.ExpectHeader != "" {
+		wantHeader = strings.Split(cmd.args.ExpectHeader, ",")
+	}
+	csvPaths := []string{cmd.args.CSVPath}
+	if cmd.args.InputGlob != "" {
+		csvPaths, err = filepath.Glob(cmd.args.InputGlob)
+		if err != nil {
+			return fmt.Errorf("--input-glob %q: %w", cmd.args.InputGlob, err)
+		}
+		if len(csvPaths) == 0 {
+			return fmt.Errorf("--input-glob %q matches no files", cmd.args.InputGlob)
+		}
+		cmd.logV("\nreading %v files matching %q\n", len(csvPaths), cmd.args.InputGlob)
+	}
+	var comma rune
+	if cmd.args.AutoDelimiter {
+		comma, err = sniffDelimiter(csvPaths[0])
+		if err != nil {
+			return err
+		}
+		cmd.logV("\ndetected delimiter %q\n", comma)
+	}
+	readOpts := csvOpts{
+		failFast:    cmd.args.FailFast,
+		mappingRow:  cmd.args.MappingRow,
+		typesRow:    cmd.args.TypesRow,
+		indexKeys:   len(cmd.args.ColumnsByIndex) > 0 || isIndexPK(pk),
+		noHeader:    cmd.args.NoHeader,
+		reuseRecord: cmd.args.CSVReuseRecord,
+		allowRagged: cmd.args.AllowRagged,
+		skipAbsent:  cmd.args.SkipAbsent,
+		healCol:     cmd.args.HealShifts,
+		warn:        cmd.warn,
+		trimEmpty:   cmd.args.TrimEmptyColumns,
+		normHeaders: cmd.args.NormalizeHeaders,
+		expectCols:  cmd.args.ExpectColumns,
+		wantHeader:  wantHeader,
+		comma:       comma,
+	}
+	file, err := readCSVs(csvPaths, readOpts)
+	if err != nil && cmd.args.RetryDelimiters && errors.Is(err, csv.ErrFieldCount) {
+		// rows of differing lengths are often fields split on the wrong
+		// delimiter
+		for _, d := range delimiters {
+			if d == comma || (comma == 0 && d == ',') {
+				continue
+			}
+			readOpts.comma = d
+			// a delimiter that's nowhere in the CSV reads one field per row
+			if retried, retryErr := readCSVs(csvPaths, readOpts); retryErr == nil && len(retried.headers) > 1 {
+				fmt.Fprintf(os.Stderr, "%v; read the CSV with the delimiter %q instead\n", err, d)
+				file, comma, err = retried, d, nil
+				break
+			}
+		}
+	}
+	if err != nil {
+		return err
+	}
+	prof.mark("read")
+	csv := file.records
+	if cmd.args.Annotate {
+		// stamp each record with its row before filtering or dedupe drops
+		// any. Statements carry the rows of the records they're built from.
+		for i, rec := range csv {
+			rec[rowKey] = strconv.Itoa(i + 1)
+		}
+	}
+	if cmd.args.Distinct != "" {
+		return writeDistinct(os.Stdout, csv, file.headers, cmd.args.Distinct)
+	}
+	if cmd.args.MappingRow {
+		cols = append(file.mapping, cols...)
+		cmd.debug("columns with mapping row", cols)
+	}
+	if len(cmd.args.ColumnsByIndex) > 0 {
+		idxCols, err := indexColumns(cmd.args.ColumnsByIndex, file.headers, cmd.args.MapSep)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, idxCols...)
+		cmd.debug("columns with index columns", cols)
+	}
+	if isIndexPK(pk) {
+		pk, err = indexPK(pk, file.headers, cmd.args.MapSep)
+		if err != nil {
+			return err
+		}
+		cmd.debug("pk column by index", pk)
+	}
+	if cmd.args.RenameMap != "" || cmd.args.AllColumns {
+		var renames []column
+		if cmd.args.RenameMap != "" {
+			renames, err = renameMap(cmd.args.RenameMap)
+			if err != nil {
+				return err
+			}
+		}
+		if cmd.args.AllColumns {
+			renamed := map[string]string{}
+			for _, col := range renames {
+				renamed[col.CSV] = col.SQL
+			}
+			for _, header := range file.headers {
+				if sqlCol, ok := renamed[header]; ok {
+					cols = append(cols, column{header, sqlCol})
+				} else {
+					cols = append(cols, column{header, header})
+				}
+			}
+		} else {
+			cols = append(cols, renames...)
+		}
+		cmd.debug("columns with renames", cols)
+	}
+	if len(cmd.args.IncludeGlobs) > 0 {
+		globCols, err := globColumns(cmd.args.IncludeGlobs, file.headers, pk, cmd.args.MapSep)
+		if err != nil {
+			return err
+		}
+		cols = append(cols, globCols...)
+		cmd.debug("columns with globs", cols)
+	}
+	if len(cols) == 0 {
+		return fmt.Errorf("no columns to update; use -c, --columns-by-index, --mapping-row, --rename-map, --all-columns or --include-glob")
+	}
+	if cmd.args.TypesRow {
+		// --type declarations take precedence over the types row
+		for _, col := range cols {
+			if _, ok := types[col.SQL]; !ok && file.types[col.CSV] != "" {
+				types[col.SQL] = file.types[col.CSV]
+			}
+		}
+		cmd.debug("column types with types row", types)
+	}
+	cols, routedTables := routeColumns(cols, file.headers)
+	if len(routedTables) > 0 {
+		if cmd.args.Base != "" || cmd.args.Mode == "values" {
+			return fmt.Errorf("table.col columns can't be used with --base or --mode values")
+		}
+		cmd.debug("columns routed to tables", routedTables)
+	}
+	cmd.debug("csv", head(csv, 5))
+	cmd.logV("...\n(%v records)\n", len(csv))
+
+	if cmd.args.FilterExpr != "" {
+		keep, err := newFilter(cmd.args.FilterExpr, file.headers)
+		if err != nil {
+			return err
+		}
+		kept := []record{}
+		for _, rec := range csv {
+			if keep(rec) {
+				kept = append(kept, rec)
+			}
+		}
+		cmd.logV("\nfiltered out %v records not matching %q\n", len(csv)-len(kept), cmd.args.FilterExpr)
+		csv = kept
+	}
+	if len(cmd.args.DedupeBy) > 0 {
+		var collapsed int
+		csv, collapsed = dedupe(csv, cmd.args.DedupeBy, cmd.args.Keep == "last")
+		cmd.logV("\ncollapsed %v records with duplicate %v, keeping the %s\n", collapsed, cmd.args.DedupeBy, cmd.args.Keep)
+	}
+
+	if cmd.args.KeepOriginal {
+		// originals go first so that a column explicitly mapped to the same
+		// name still wins. The pk is appended after, so it's never duplicated,
+		// and index columns have no original name to keep.
+		// Routed columns keep their original in the same table.
+		originals := []column{}
+		isRouted := set(routedTables)
+		for _, col := range cols {
+			table, sqlCol := "", col.SQL
+			if t, c, ok := strings.Cut(col.SQL, "."); ok && isRouted[t] {
+				table, sqlCol = t+".", c
+			}
+			if col.CSV != sqlCol && !strings.HasPrefix(col.CSV, "#") && col.CSV != pk.SQL {
+				originals = append(originals, column{col.CSV, table + col.CSV})
+			}
+		}
+		cols = append(originals, cols...)
+		cmd.debug("columns with originals", cols)
+	}
+	if cmd.args.CommentColumn != "" {
+		// the comment column is written as a comment, never assigned
+		kept := []column{}
+		for _, col := range cols {
+			if col.CSV != cmd.args.CommentColumn {
+				kept = append(kept, col)
+			}
+		}
+		cols = kept
+	}
+	if cmd.args.PlanJSON {
+		// planned once the columns are final, with any originals and
+		// without the comment column
+		return writePlan(os.Stdout, newPlan(cmd.args, outputDialect, cmd.args.Table, routedTables, pk, cols, matchCols, guardCols, types, valTransforms, lks, rawAssigns))
+	}
+	cols = append(cols, matchCols...)
+	cols = append(cols, pk)
+	updates, err := sqlRecords(csv, cols, valTransforms, lks, cmd.args.CIValues, cmd.args.NullLiteral)
 	if err != nil {
 		return err
 	}
-	sort.Slice(updates, func(i, j int) bool {
+	if cmd.args.PKGenerate != nil && len(updates) > 0 {
+		next := *cmd.args.PKGenerate
+		for _, upd := range updates {
+			upd[pk.SQL] = strconv.FormatInt(next, 10)
+			next++
+		}
+		// reported regardless of --verbose, since the next load needs it
+		fmt.Fprintf(os.Stderr, "generated %s %v to %v\n", pk.SQL, *cmd.args.PKGenerate, next-1)
+	}
+	if cmd.args.HashColumn != "" {
+		hashRecords(updates, cmd.args.HashColumn, cols)
+	}
+	if cmd.args.CommentColumn != "" {
+		if !set(file.headers)[cmd.args.CommentColumn] {
+			return fmt.Errorf("--comment-column %q isn't a CSV header", cmd.args.CommentColumn)
+		}
+		// each record carries its own note, so records sharing a pk keep
+		// theirs apart
+		for i, upd := range updates {
+			if note := csv[i][cmd.args.CommentColumn]; note != "" {
+				upd[noteKey] = note
+			}
+		}
+	}
+	if cmd.args.SkipMissingPK {
+		var skipped int
+		updates, skipped = withPK(updates, pk)
+		cmd.logV("\nskipped %v records missing pk %q\n", skipped, pk.SQL)
+	}
+	if cmd.args.Sample > 0 {
+		seed := time.Now().UnixNano()
+		if cmd.args.Seed != nil {
+			seed = *cmd.args.Seed
+		}
+		cmd.logV("\nsampling %v records with seed %v\n", cmd.args.Sample, seed)
+		updates = sample(updates, cmd.args.Sample, rand.New(rand.NewSource(seed)))
+	}
+	sort.SliceStable(updates, func(i, j int) bool {
 		return updates[i][pk.SQL] < updates[j][pk.SQL]
 	})
+	if len(cmd.args.SortBy) > 0 && len(updates) > 0 {
+		for _, col := range cmd.args.SortBy {
+			if !hasColumn(updates, col) {
+				return fmt.Errorf("can't --sort-by %q; it isn't an sql column", col)
+			}
+		}
+		// records equal on every key stay in pk order
+		sort.SliceStable(updates, func(i, j int) bool {
+			for _, col := range cmd.args.SortBy {
+				c := compareValues(updates[i][col], updates[j][col])
+				if cmd.args.SortDesc {
+					c = -c
+				}
+				if c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	if ints, others := pkTypes(updates, pk); cmd.args.PKType == "" && ints > 0 && others > 0 {
+		err := cmd.warn("pk %q has %v integer and %v non-integer values", pk.SQL, ints, others)
+		if err != nil {
+			return err
+		}
+	}
+	if cmd.args.Preview > 0 {
+		if err := writeTable(os.Stderr, head(updates, cmd.args.Preview)); err != nil {
+			return err
+		}
+	}
 	cmd.debug("updates", head(updates, 5))
 	cmd.logV("...\n(%v records)\n", len(updates))
+	prof.mark("transform")
 
-	stmts, err := updateQueries(updates, cmd.args.Table, pk)
-	sql := strings.Join(stmts, ";\n") + ";"
-	fmt.Println(sql)
-	return nil
+	var base map[string]record
+	if cmd.args.Base != "" {
+		baseFile, err := readCSV(cmd.args.Base, csvOpts{
+			failFast:    cmd.args.FailFast,
+			mappingRow:  cmd.args.MappingRow,
+			typesRow:    cmd.args.TypesRow,
+			indexKeys:   readOpts.indexKeys,
+			noHeader:    cmd.args.NoHeader,
+			reuseRecord: cmd.args.CSVReuseRecord,
+			allowRagged: cmd.args.AllowRagged,
+			trimEmpty:   cmd.args.TrimEmptyColumns,
+			normHeaders: cmd.args.NormalizeHeaders,
+			comma:       comma,
+		})
+		if err != nil {
+			return err
+		}
+		baseRecords, err := sqlRecords(baseFile.records, append(cols, guardCols...), valTransforms, lks, cmd.args.CIValues, cmd.args.NullLiteral)
+		if err != nil {
+			return err
+		}
+		if cmd.args.HashColumn != "" {
+			hashRecords(baseRecords, cmd.args.HashColumn, cols)
+		}
+		base = recordsByPK(baseRecords, pk)
+		prof.mark("read base")
+	}
+	if len(guardCols) > 0 {
+		var missing int
+		updates, missing = inBase(updates, base, pk)
+		if missing > 0 {
+			err := cmd.warn("%v records are missing from %s and can't be guarded; skipping them", missing, cmd.args.Base)
+			if err != nil {
+				return err
+			}
+		}
+		cmd.logV("\nguarding %v statements on their --base values of %v\n", len(updates), cmd.args.GuardColumns)
+	}
+
+	affix := func(table string) string {
+		return cmd.args.TablePrefix + table + cmd.args.TableSuffix
+	}
+	table := affix(cmd.args.Table)
+	// one set of records per table, starting with the --table's own
+	splits := []tableRecords{{table, updates, table + ".sql"}}
+	if len(routedTables) > 0 {
+		splits = splitTables(updates, cmd.args.Table, routedTables, pk)
+		for i := range splits {
+			splits[i].table = affix(splits[i].table)
+			splits[i].file = splits[i].table + ".sql"
+		}
+	}
+	if cmd.args.PartitionBy != "" {
+		if len(routedTables) > 0 {
+			return fmt.Errorf("--partition-by can't be used with table.col columns")
+		}
+		if len(updates) > 0 {
+			if !hasColumn(updates, cmd.args.PartitionBy) {
+				return fmt.Errorf("can't --partition-by %q; it isn't an sql column", cmd.args.PartitionBy)
+			}
+		}
+		splits = partitionRecords(updates, cmd.args.PartitionBy, table)
+	}
+	opts := queryOpts{
+		flavor:            flavor,
+		pkType:            cmd.args.PKType,
+		nullPK:            cmd.args.NullPK,
+		nullMatch:         cmd.args.NullMatch,
+		rawAssigns:        rawAssigns,
+		rawCols:           set(cmd.args.RawColumns),
+		hexCols:           set(cmd.args.HexColumns),
+		funcCols:          set(cmd.args.FuncColumns),
+		jsonCols:          set(cmd.args.JSONColumns),
+		arrayCols:         set(cmd.args.ArrayColumns),
+		emptyStringCols:   set(cmd.args.EmptyStringColumns),
+		defaultCols:       set(cmd.args.DefaultColumns),
+		types:             types,
+		lenientTypes:      cmd.args.LenientTypes,
+		noInterpolate:     cmd.args.NoInterpolate,
+		groupIdentical:    cmd.args.GroupIdentical,
+		parallelism:       cmd.args.Parallelism,
+		batchSize:         cmd.args.BatchSize,
+		batchStyle:        cmd.args.BatchStyle,
+		maxStatementBytes: cmd.args.MaxStatementBytes,
+		guardCols:         guardCols,
+		matchCols:         matchCols,
+		emitNoops:         cmd.args.EmitNoops,
+		limitOne:          cmd.args.UpdateLimit1,
+		columnOrder:       columnOrder,
+		base:              base,
+		warn:              cmd.warn,
+		profile:           prof,
+		numberLocale:      numLocale,
+		autoDate:          cmd.args.AutoDate,
+		stripCurrency:     cmd.args.StripCurrency,
+		nullLiteral:       cmd.args.NullLiteral,
+		ciValues:          cmd.args.CIValues,
+	}
+	var tmpl *template.Template
+	if cmd.args.Template != "" {
+		tmpl, err = newTemplate(cmd.args.Template, flavor)
+		if err != nil {
+			return err
+		}
+	}
+	var stmts []statement
+	// tableEnds[i] is the end of the statements of splits[i] in stmts
+	tableEnds := []int{}
+	// loadData holds the csv of each --mode load-data file by path
+	loadData := map[string]string{}
+	loadPaths := []string{}
+	for _, split := range splits {
+		var tableStmts []statement
+		switch {
+		case tmpl != nil:
+			tableStmts, err = templateQueries(tmpl, split.records, split.table, pk, opts)
+		case cmd.args.Mode == "update":
+			tableStmts, err = updateQueries(split.records, split.table, pk, opts)
+		case cmd.args.Mode == "insert", cmd.args.Mode == "insert-ignore":
+			tableStmts, err = insertQueries(split.records, cols, split.table, pk, cmd.args.Mode == "insert-ignore", opts)
+		case cmd.args.Mode == "create-table":
+			var stmt statement
+			stmt, err = createTableQuery(split.records, split.table, pk, opts)
+			tableStmts = []statement{stmt}
+		case cmd.args.Mode == "values":
+			tableStmts, err = valuesQueries(split.records, cols, pk, opts)
+		case cmd.args.Mode == "update-case":
+			tableStmts, err = updateCaseQueries(split.records, split.table, pk, opts)
+		case cmd.args.Mode == "copy" && len(split.records) > 0:
+			var stmt statement
+			stmt, err = copyQuery(split.records, split.table, pk, opts)
+			tableStmts = []statement{stmt}
+		case cmd.args.Mode == "load-data" && len(split.records) > 0:
+			path := filepath.Join(loadDataDir, strings.TrimSuffix(split.file, ".sql")+".csv")
+			var stmt statement
+			stmt, loadData[path], err = loadDataQuery(split.records, split.table, path, pk, opts)
+			tableStmts = []statement{stmt}
+			loadPaths = append(loadPaths, path)
+		}
+		if err != nil {
+			return err
+		}
+		stmts = append(stmts, tableStmts...)
+		tableEnds = append(tableEnds, len(stmts))
+	}
+	if cmd.args.CommentColumn != "" {
+		for i := range stmts {
+			if stmts[i].SQL != "" {
+				stmts[i].Comment = noteComment(stmts[i])
+			}
+		}
+	}
+	prof.mark("build")
+	if cmd.args.VerifySQL {
+		if err := verifySQL(stmts, flavor); err != nil {
+			return err
+		}
+		cmd.logV("\nverified %v statements\n", len(stmts))
+		prof.mark("verify")
+	}
+	if cmd.args.CheckDB != "" {
+		if err := checkDB(stmts, flavor, cmd.args.CheckDB); err != nil {
+			return err
+		}
+		cmd.logV("\nchecked %v statements against %s, rolling back\n", len(stmts), maskDSN(cmd.args.CheckDB))
+		prof.mark("check db")
+	}
+	if cmd.args.ExplainSQL {
+		explain := "EXPLAIN "
+		if flavor == sqlbuilder.SQLite {
+			explain = "EXPLAIN QUERY PLAN "
+		}
+		for i := range stmts {
+			if stmts[i].SQL != "" {
+				stmts[i].SQL = explain + stmts[i].SQL
+			}
+		}
+	}
+	if cmd.args.ConfirmOver > 0 && len(stmts) > cmd.args.ConfirmOver {
+		if err := cmd.confirm(fmt.Sprintf("write %v statements?", len(stmts))); err != nil {
+			return err
+		}
+	}
+	if len(stmts) == 0 && cmd.args.ExitOnEmpty {
+		return fmt.Errorf("no statements generated")
+	}
+	if len(loadPaths) > 0 {
+		if err := os.MkdirAll(loadDataDir, 0o755); err != nil {
+			return err
+		}
+		for _, path := range loadPaths {
+			if err := os.WriteFile(path, []byte(loadData[path]), 0o644); err != nil {
+				return err
+			}
+		}
+		cmd.logV("\nwrote %v csv files for LOAD DATA to %s\n", len(loadPaths), loadDataDir)
+	}
+
+	written := []manifestFile{}
+	down, downCount := updateDownMigration, 0
+	switch cmd.args.Mode {
+	case "create-table":
+		drops := []statement{}
+		for _, split := range splits {
+			drops = append(drops, statement{SQL: "DROP TABLE IF EXISTS " + split.table})
+		}
+		down, downCount = cmd.script(drops), len(drops)
+	case "insert", "insert-ignore", "copy", "load-data":
+		deletes := []statement{}
+		for _, split := range splits {
+			tableDeletes, err := deleteQueries(split.records, split.table, pk, opts)
+			if err != nil {
+				return err
+			}
+			deletes = append(deletes, tableDeletes...)
+		}
+		down, downCount = cmd.script(deletes), len(deletes)
+	}
+	if cmd.args.Base != "" {
+		inverse, missing := inverseRecords(updates, base, pk, matchCols)
+		if missing > 0 {
+			err := cmd.warn("%v records are missing from %s and can't be inverted", missing, cmd.args.Base)
+			if err != nil {
+				return err
+			}
+		}
+		// inverse records set different columns, so build them one by one
+		downOpts := opts
+		downOpts.rawAssigns = nil
+		downOpts.groupIdentical = false
+		downOpts.guardCols = nil
+		downStmts := []statement{}
+		for _, inv := range inverse {
+			stmts, err := updateQueries([]record{inv}, table, pk, downOpts)
+			if err != nil {
+				return err
+			}
+			downStmts = append(downStmts, stmts...)
+		}
+		down, downCount = cmd.script(downStmts), len(downStmts)
+		if cmd.args.DownOut != "" {
+			if err := os.WriteFile(cmd.args.DownOut, []byte(down), 0o644); err != nil {
+				return err
+			}
+			cmd.logV("\nwrote %v inverse statements to %s\n", downCount, cmd.args.DownOut)
+			written = append(written, newManifestFile(cmd.args.DownOut, down, downCount))
+		}
+	}
+
+	if cmd.args.Migration != "" {
+		up := cmd.script(stmts)
+		upPath, downPath, err := writeMigration(cmd.args.Out, cmd.args.Migration, up, down)
+		if err != nil {
+			return err
+		}
+		cmd.logV("\nwrote %s and %s\n", upPath, downPath)
+		written = append(written,
+			newManifestFile(upPath, up, len(stmts)),
+			newManifestFile(downPath, down, downCount))
+	}
+	filePerSplit := cmd.args.OutputPerTable || cmd.args.PartitionBy != ""
+	if filePerSplit {
+		if err := os.MkdirAll(cmd.args.Out, 0o755); err != nil {
+			return err
+		}
+		start := 0
+		for i, split := range splits {
+			tableStmts := stmts[start:tableEnds[i]]
+			start = tableEnds[i]
+			path := filepath.Join(cmd.args.Out, split.file)
+			script := cmd.script(tableStmts)
+			if err := os.WriteFile(path, []byte(script), 0o644); err != nil {
+				return err
+			}
+			cmd.logV("\nwrote %v statements to %s\n", len(tableStmts), path)
+			written = append(written, newManifestFile(path, script, len(tableStmts)))
+		}
+	}
+	manifest := cmd.args.Manifest
+	if manifest == "" && filePerSplit {
+		manifest = filepath.Join(cmd.args.Out, "manifest.json")
+	}
+	if manifest != "" {
+		if err := writeManifest(manifest, written); err != nil {
+			return err
+		}
+		cmd.logV("\nwrote manifest of %v files to %s\n", len(written), manifest)
+	}
+	if cmd.args.Migration != "" || filePerSplit {
+		prof.mark("write")
+		return nil
+	}
+	out := bufio.NewWriter(os.Stdout)
+	err = cmd.writeScript(out, stmts, cmd.args.FlushEvery)
+	// flush whatever was written even if writing failed
+	if flushErr := out.Flush(); err == nil {
+		err = flushErr
+	}
+	prof.mark("write")
+	return err
 }
 
 func main() {
@@ -244,6 +2548,7 @@ func main() {
 	app := updateCmd{
 		args:    args,
 		verbose: args.Verbose,
+		color:   !args.NoColor && isTerminal(os.Stderr),
 	}
 	if err := app.run(); err != nil {
 		fmt.Println(err)
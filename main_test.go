@@ -0,0 +1,349 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func TestValue(t *testing.T) {
+	cols := map[string]bool{"col": true}
+	tests := []struct {
+		name string
+		opts queryOpts
+		v    string
+		want any
+	}{
+		{"empty is NULL", queryOpts{}, "", nil},
+		{"now() is raw", queryOpts{}, "now()", sqlbuilder.Raw("now()")},
+		{"other case of now() is a string", queryOpts{}, "NOW()", "NOW()"},
+		{"integer", queryOpts{}, "42", int64(42)},
+		{"negative integer", queryOpts{}, "-7", int64(-7)},
+		{"string", queryOpts{}, "abc", "abc"},
+		{"decimal is a string", queryOpts{}, "1.5", "1.5"},
+		{"empty string column", queryOpts{emptyStringCols: cols}, "", ""},
+		{"empty string column value", queryOpts{emptyStringCols: cols}, "7", int64(7)},
+		{"default column", queryOpts{defaultCols: cols}, "", sqlbuilder.Raw("DEFAULT")},
+		{"default column value", queryOpts{defaultCols: cols}, "x", "x"},
+		{"empty string column wins over default", queryOpts{emptyStringCols: cols, defaultCols: cols}, "", ""},
+		{"raw column", queryOpts{rawCols: cols}, "a + 1", sqlbuilder.Raw("a + 1")},
+		{"raw column empty is NULL", queryOpts{rawCols: cols}, "", nil},
+		{"raw column number is raw", queryOpts{rawCols: cols}, "42", sqlbuilder.Raw("42")},
+		{"ci values now()", queryOpts{ciValues: true}, "NOW()", sqlbuilder.Raw("NOW()")},
+		{"ci values empty default", queryOpts{ciValues: true, defaultCols: cols}, "", sqlbuilder.Raw("DEFAULT")},
+		{"ci values other string", queryOpts{ciValues: true}, "Now", "Now"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := test.opts.value("col", test.v)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("value(%q) = %#v, want %#v", test.v, got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateQueriesDeterministic(t *testing.T) {
+	csv := []record{
+		{"id": "1", "name": "a", "status": "active", "score": "5", "city": "x"},
+		{"id": "2", "name": "b", "status": "gone", "score": "", "city": "y"},
+		{"id": "3", "name": "c", "status": "active", "score": "7", "city": "z"},
+	}
+	cols := []column{{"name", "name"}, {"status", "state"}, {"score", "score"}, {"city", "town"}, {"id", "id"}}
+	opts := queryOpts{flavor: sqlbuilder.MySQL}
+	build := func() []statement {
+		updates, err := sqlRecords(csv, cols, nil, nil, false, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stmts, err := updateQueries(updates, "t", column{"id", "id"}, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stmts
+	}
+	want := build()
+	// map iteration order differs between runs, so build several times
+	for i := 0; i < 10; i++ {
+		if got := build(); !reflect.DeepEqual(got, want) {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+	if got := want[0].String(); got != "UPDATE t SET name = 'a', score = 5, state = 'active', town = 'x' WHERE id = 1;" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestReadCSVTabsCRLF(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.tsv")
+	data := "id\tname\tnote\r\n1\ta b\t\"x, y\"\r\n2\tc\t\r\n"
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readCSV(path, csvOpts{comma: '\t'})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"id", "name", "note"}; !reflect.DeepEqual(file.headers, want) {
+		t.Errorf("headers = %q, want %q", file.headers, want)
+	}
+	want := []record{
+		{"id": "1", "name": "a b", "note": "x, y"},
+		{"id": "2", "name": "c", "note": ""},
+	}
+	if !reflect.DeepEqual(file.records, want) {
+		t.Errorf("records = %q, want %q", file.records, want)
+	}
+}
+
+func BenchmarkSQLRecords(b *testing.B) {
+	const nCols, nRecords, nTransforms = 200, 1000, 100
+	cols := []column{}
+	for i := 0; i < nCols; i++ {
+		cols = append(cols, column{fmt.Sprintf("c%d", i), fmt.Sprintf("s%d", i)})
+	}
+	tfs := []transform{}
+	for i := 0; i < nTransforms; i++ {
+		tfs = append(tfs, transform{fmt.Sprintf("v%d", i), fmt.Sprintf("w%d", i)})
+	}
+	csv := []record{}
+	for i := 0; i < nRecords; i++ {
+		rec := record{}
+		for j, col := range cols {
+			rec[col.CSV] = fmt.Sprintf("v%d", (i+j)%(2*nTransforms))
+		}
+		csv = append(csv, rec)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := sqlRecords(csv, cols, tfs, nil, true, false); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// parallelRecords are sql records to build statements from in n workers.
+func parallelRecords(n int) []record {
+	updates := []record{}
+	for i := 0; i < n; i++ {
+		updates = append(updates, record{"id": fmt.Sprint(i), "name": fmt.Sprintf("n%d", i), "score": fmt.Sprint(i % 100)})
+	}
+	return updates
+}
+
+func TestParallelismSameOutput(t *testing.T) {
+	updates := parallelRecords(2000)
+	pk := column{"id", "id"}
+	build := func(workers int) ([]statement, []statement) {
+		opts := queryOpts{flavor: sqlbuilder.MySQL, parallelism: workers, batchSize: 3}
+		upd, err := updateQueries(updates, "t", pk, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ins, err := insertQueries(updates, nil, "t", pk, false, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return upd, ins
+	}
+	wantUpd, wantIns := build(1)
+	for _, workers := range []int{2, 8} {
+		upd, ins := build(workers)
+		if !reflect.DeepEqual(upd, wantUpd) {
+			t.Errorf("updates with --parallelism %d differ from 1", workers)
+		}
+		if !reflect.DeepEqual(ins, wantIns) {
+			t.Errorf("inserts with --parallelism %d differ from 1", workers)
+		}
+	}
+}
+
+func BenchmarkParallelism(b *testing.B) {
+	updates := parallelRecords(20000)
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			opts := queryOpts{flavor: sqlbuilder.MySQL, parallelism: workers}
+			for i := 0; i < b.N; i++ {
+				if _, err := updateQueries(updates, "t", column{"id", "id"}, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkReadCSV(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "in.csv")
+	f, err := os.Create(path)
+	if err != nil {
+		b.Fatal(err)
+	}
+	fmt.Fprintln(f, "id,name,status,score,note")
+	for i := 0; i < 10000; i++ {
+		fmt.Fprintf(f, "%d,name %d,active,%d,\"a, b\"\n", i, i, i%100)
+	}
+	if err := f.Close(); err != nil {
+		b.Fatal(err)
+	}
+	for _, reuse := range []bool{false, true} {
+		b.Run(fmt.Sprintf("reuseRecord=%v", reuse), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := readCSV(path, csvOpts{reuseRecord: reuse}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestSQLRecordsOneCSVColumnToSeveral(t *testing.T) {
+	cols := []column{{"name", "name"}, {"name", "name_normalized"}, {"id", "id"}}
+	tfs := []transform{{"a", "b"}, {"b", "c"}}
+	lks := []lookup{{Col: "name_normalized", Vals: map[string]string{"Bob ": "bob"}}}
+	csv := []record{{"id": "1", "name": "Bob "}, {"id": "2", "name": "a"}}
+	got, err := sqlRecords(csv, cols, tfs, lks, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each column transforms the csv value on its own, so the lookup of
+	// one doesn't reach the other, and a->b isn't followed by b->c
+	want := []record{
+		{"id": "1", "name": "Bob ", "name_normalized": "bob"},
+		{"id": "2", "name": "b", "name_normalized": "b"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTransformToEmptyIsNull(t *testing.T) {
+	tfs, err := transforms([]string{"N/A->"}, "->")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cols := []column{{"score", "score"}, {"id", "id"}}
+	updates, err := sqlRecords([]record{{"id": "1", "score": "N/A"}}, cols, tfs, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmts, err := updateQueries(updates, "t", column{"id", "id"}, queryOpts{flavor: sqlbuilder.MySQL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "UPDATE t SET score = NULL WHERE id = 1;"
+	if len(stmts) != 1 || stmts[0].String() != want {
+		t.Errorf("got %q, want %q", stmts, want)
+	}
+}
+
+func TestCIValues(t *testing.T) {
+	for _, v := range []string{"now()", "NOW()", "Now()"} {
+		got, err := queryOpts{ciValues: true}.value("col", v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := sqlbuilder.Raw(v); !reflect.DeepEqual(got, want) {
+			t.Errorf("with ciValues, value(%q) = %#v, want %#v", v, got, want)
+		}
+		if v == "now()" {
+			continue
+		}
+		if got, _ := (queryOpts{}).value("col", v); got != v {
+			t.Errorf("without ciValues, value(%q) = %#v, want %q", v, got, v)
+		}
+	}
+
+	tfs := []transform{{"N/A", ""}, {"Yes", "1"}}
+	cols := []column{{"v", "v"}}
+	csv := []record{{"v": "n/a"}, {"v": "N/A"}, {"v": "YES"}, {"v": "yes"}, {"v": "Nope"}}
+	got, err := sqlRecords(csv, cols, tfs, nil, true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []record{{"v": ""}, {"v": ""}, {"v": "1"}, {"v": "1"}, {"v": "Nope"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with ciValues, got %q, want %q", got, want)
+	}
+	got, err = sqlRecords(csv, cols, tfs, nil, false, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []record{{"v": "n/a"}, {"v": ""}, {"v": "YES"}, {"v": "yes"}, {"v": "Nope"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("without ciValues, got %q, want %q", got, want)
+	}
+}
+
+func TestSciNumber(t *testing.T) {
+	tests := []struct {
+		v    string
+		want any
+		ok   bool
+	}{
+		{"1E6", int64(1000000), true},
+		{"2.5e-3", 0.0025, true},
+		{"1.23E+10", int64(12300000000), true},
+		{"-4e2", int64(-400), true},
+		{"1e400", nil, false},
+		{"12", nil, false},
+		{"e6", nil, false},
+		{"1E6x", nil, false},
+	}
+	for _, test := range tests {
+		got, ok := sciNumber(test.v)
+		if ok != test.ok || !reflect.DeepEqual(got, test.want) {
+			t.Errorf("sciNumber(%q) = %#v, %v, want %#v, %v", test.v, got, ok, test.want, test.ok)
+		}
+	}
+	// through intif, whole numbers are ints and others floats
+	if got := intif("1E6"); got != int64(1000000) {
+		t.Errorf("intif(1E6) = %#v", got)
+	}
+	if got := intif("2.5e-3"); got != 0.0025 {
+		t.Errorf("intif(2.5e-3) = %#v", got)
+	}
+}
+
+func TestHasColumn(t *testing.T) {
+	// with --skip-absent the first record can lack a column the rest have
+	records := []record{{"id": "1", "a": "x", rowKey: "1"}, {"id": "2", "a": "y", "b": "z"}}
+	for col, want := range map[string]bool{"a": true, "b": true, "c": false, rowKey: false} {
+		if got := hasColumn(records, col); got != want {
+			t.Errorf("hasColumn(%q) = %v, want %v", col, got, want)
+		}
+	}
+}
+
+func TestReadCSVNoHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "in.csv")
+	if err := os.WriteFile(path, []byte("1,a\n2,b\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := readCSV(path, csvOpts{noHeader: true, indexKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the first row is data, not a header
+	want := []record{{"#0": "1", "#1": "a"}, {"#0": "2", "#1": "b"}}
+	if !reflect.DeepEqual(file.records, want) {
+		t.Errorf("records = %q, want %q", file.records, want)
+	}
+	pk, err := indexPK(column{"#0", "id"}, file.headers, "->")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (column{"#0", "id"}); pk != want {
+		t.Errorf("pk = %v, want %v", pk, want)
+	}
+	if _, err := indexPK(column{"#1", "#1"}, file.headers, "->"); err == nil {
+		t.Error("want an error for a headerless pk without an alias")
+	}
+}
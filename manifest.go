@@ -0,0 +1,30 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+)
+
+// manifestFile describes an output file in the --manifest.
+type manifestFile struct {
+	Path       string `json:"path"`
+	Statements int    `json:"statements"`
+	SHA256     string `json:"sha256"`
+}
+
+func newManifestFile(path, content string, statements int) manifestFile {
+	sum := sha256.Sum256([]byte(content))
+	return manifestFile{path, statements, hex.EncodeToString(sum[:])}
+}
+
+func writeManifest(path string, files []manifestFile) error {
+	b, err := json.MarshalIndent(struct {
+		Files []manifestFile `json:"files"`
+	}{files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(b, '\n'), 0o644)
+}
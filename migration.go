@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+)
+
+// updateDownMigration is the down file written for UPDATE statements when
+// there's no --base to derive their inverse from. Inserts are undone with
+// DELETEs.
+const updateDownMigration = "-- csv2sql: the inverse of these updates can't be derived from the CSV\n"
+
+var migrationFile = regexp.MustCompile(`^(\d+)_.*\.(up|down)\.sql$`)
+
+// nextMigrationVersion returns one more than the highest version among the
+// golang-migrate style files in dir, or 1 if there are none.
+func nextMigrationVersion(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	latest := 0
+	for _, entry := range entries {
+		m := migrationFile.FindStringSubmatch(entry.Name())
+		if m == nil {
+			continue
+		}
+		version, err := strconv.Atoi(m[1])
+		if err != nil {
+			return 0, err
+		}
+		if version > latest {
+			latest = version
+		}
+	}
+	return latest + 1, nil
+}
+
+// writeMigration writes up and down as the next version's migration files
+// in dir, creating dir if need be.
+func writeMigration(dir, name, up, down string) (upPath, downPath string, err error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return upPath, downPath, err
+	}
+	version, err := nextMigrationVersion(dir)
+	if err != nil {
+		return upPath, downPath, err
+	}
+	prefix := filepath.Join(dir, fmt.Sprintf("%03d_%s", version, name))
+	upPath, downPath = prefix+".up.sql", prefix+".down.sql"
+	if err := os.WriteFile(upPath, []byte(up), 0o644); err != nil {
+		return upPath, downPath, err
+	}
+	if err := os.WriteFile(downPath, []byte(down), 0o644); err != nil {
+		return upPath, downPath, err
+	}
+	return upPath, downPath, nil
+}
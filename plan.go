@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// plan is the resolved generation plan written by --plan-json, so a
+// wrapping program can check how its flags were interpreted.
+type plan struct {
+	Mode            string           `json:"mode"`
+	Dialect         string           `json:"dialect"`
+	OutputDialect   string           `json:"output_dialect"`
+	Table           string           `json:"table"`
+	Tables          []string         `json:"tables,omitempty"`
+	PK              planColumn       `json:"pk"`
+	Columns         []planColumn     `json:"columns"`
+	MatchColumns    []planColumn     `json:"match_columns,omitempty"`
+	GuardColumns    []planColumn     `json:"guard_columns,omitempty"`
+	ValueTransforms []planTransform  `json:"value_transforms,omitempty"`
+	Lookups         []planLookup     `json:"lookups,omitempty"`
+	AssignRaw       []planAssignment `json:"assign_raw,omitempty"`
+}
+
+// planColumn is a column by its CSV header and sql name, with its declared
+// type if any.
+type planColumn struct {
+	CSV  string `json:"csv"`
+	SQL  string `json:"sql"`
+	Type string `json:"type,omitempty"`
+}
+
+type planTransform struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type planLookup struct {
+	Column string `json:"column"`
+	Path   string `json:"path"`
+	Strict bool   `json:"strict"`
+}
+
+type planAssignment struct {
+	Column string `json:"column"`
+	Expr   string `json:"expr"`
+}
+
+func planColumns(cols []column, types map[string]string) []planColumn {
+	pcols := []planColumn{}
+	for _, col := range cols {
+		pcols = append(pcols, planColumn{col.CSV, col.SQL, types[col.SQL]})
+	}
+	return pcols
+}
+
+func newPlan(a args, outputDialect, table string, tables []string, pk column, cols, matchCols, guardCols []column, types map[string]string, tfs []transform, lks []lookup, asgs []assignment) plan {
+	affix := func(table string) string {
+		return a.TablePrefix + table + a.TableSuffix
+	}
+	p := plan{
+		Mode:          a.Mode,
+		Dialect:       a.Dialect,
+		OutputDialect: outputDialect,
+		Table:         affix(table),
+		PK:            planColumn{pk.CSV, pk.SQL, types[pk.SQL]},
+		Columns:       planColumns(cols, types),
+		MatchColumns:  planColumns(matchCols, types),
+		GuardColumns:  planColumns(guardCols, types),
+	}
+	for _, t := range tables {
+		p.Tables = append(p.Tables, affix(t))
+	}
+	for _, tf := range tfs {
+		p.ValueTransforms = append(p.ValueTransforms, planTransform{tf.CSV, tf.SQL})
+	}
+	for _, lk := range lks {
+		p.Lookups = append(p.Lookups, planLookup{lk.Col, lk.Path, lk.Strict})
+	}
+	for _, asg := range asgs {
+		p.AssignRaw = append(p.AssignRaw, planAssignment{asg.Col, asg.Expr})
+	}
+	return p
+}
+
+func writePlan(w io.Writer, p plan) error {
+	b, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
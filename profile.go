@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+)
+
+type phase struct {
+	name string
+	took time.Duration
+}
+
+// profile records how long each phase of a run takes, for --profile. A nil
+// *profile records nothing, so callers needn't check whether it's enabled.
+type profile struct {
+	last   time.Time
+	phases []phase
+	// interpolateNanos accumulates time spent interpolating args into
+	// statements, which happens inside the build phase and across workers
+	interpolateNanos int64
+}
+
+func newProfile() *profile {
+	return &profile{last: time.Now()}
+}
+
+// mark ends the current phase, attributing the time since the last mark to it.
+func (p *profile) mark(name string) {
+	if p == nil {
+		return
+	}
+	now := time.Now()
+	p.phases = append(p.phases, phase{name, now.Sub(p.last)})
+	p.last = now
+}
+
+// interpolating adds the time since start to the interpolation total.
+func (p *profile) interpolating(start time.Time) {
+	if p == nil {
+		return
+	}
+	atomic.AddInt64(&p.interpolateNanos, int64(time.Since(start)))
+}
+
+func (p *profile) write(w io.Writer) {
+	if p == nil {
+		return
+	}
+	var total time.Duration
+	for _, ph := range p.phases {
+		total += ph.took
+	}
+	fmt.Fprintln(w, "\nprofile:")
+	for _, ph := range p.phases {
+		fmt.Fprintf(w, "  %-12s %12v  %5.1f%%\n", ph.name, ph.took, percent(ph.took, total))
+	}
+	interpolate := time.Duration(atomic.LoadInt64(&p.interpolateNanos))
+	fmt.Fprintf(w, "  %-12s %12v  (within build, summed across workers)\n", "interpolate", interpolate)
+	fmt.Fprintf(w, "  %-12s %12v\n", "total", total)
+}
+
+func percent(d, total time.Duration) float64 {
+	if total == 0 {
+		return 0
+	}
+	return 100 * float64(d) / float64(total)
+}
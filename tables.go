@@ -0,0 +1,114 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/exp/maps"
+)
+
+// routeColumns finds the columns given as "table.col", which set col in
+// another table than the --table, when the CSV has a "col" header but no
+// "table.col" one. Their sql names are prefixed with the table, to keep
+// columns of the same name in different tables apart until splitTables.
+func routeColumns(cols []column, headers []string) (routed []column, tables []string) {
+	isHeader := set(headers)
+	seen := map[string]bool{}
+	for _, col := range cols {
+		table, csvCol, ok := strings.Cut(col.CSV, ".")
+		if ok && table != "" && !isHeader[col.CSV] && isHeader[csvCol] {
+			sqlCol := col.SQL
+			if sqlCol == col.CSV {
+				sqlCol = csvCol
+			}
+			col = column{csvCol, table + "." + sqlCol}
+			if !seen[table] {
+				seen[table] = true
+				tables = append(tables, table)
+			}
+		}
+		routed = append(routed, col)
+	}
+	return routed, tables
+}
+
+type tableRecords struct {
+	table   string
+	records []record
+	// file is where --output-per-table or --partition-by write the records'
+	// statements, within --out
+	file string
+}
+
+// splitTables splits each record into one per table, each with the pk and
+// that table's columns, starting with the --table's own unless it has none.
+func splitTables(records []record, table string, tables []string, pk column) []tableRecords {
+	isRouted := set(tables)
+	byTable := map[string][]record{}
+	for _, rec := range records {
+		split := map[string]record{}
+		for _, t := range append([]string{table}, tables...) {
+			split[t] = record{pk.SQL: rec[pk.SQL]}
+		}
+		for key, v := range rec {
+			if isMetaKey(key) {
+				// every table's statements come from the same csv row
+				for t := range split {
+					split[t][key] = v
+				}
+			} else if t, col, ok := strings.Cut(key, "."); ok && isRouted[t] {
+				split[t][col] = v
+			} else {
+				split[table][key] = v
+			}
+		}
+		for t, r := range split {
+			byTable[t] = append(byTable[t], r)
+		}
+	}
+
+	splits := []tableRecords{}
+	if len(records) == 0 || len(sqlColumns(byTable[table][0])) > 1 {
+		splits = append(splits, tableRecords{table, byTable[table], table + ".sql"})
+	}
+	for _, t := range tables {
+		splits = append(splits, tableRecords{t, byTable[t], t + ".sql"})
+	}
+	return splits
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// partitionFile is the shard_VALUE.sql file of the partition of value v. A
+// value that's empty or has characters unsafe in a file name is sanitized
+// and suffixed with a short hash of it, so that values like "a/b" and "a_b"
+// get files of their own, and an empty value is written to shard__HASH.sql.
+func partitionFile(v string) string {
+	name := unsafeFileChars.ReplaceAllString(v, "_")
+	if name == "" || name != v {
+		sum := sha256.Sum256([]byte(v))
+		name += "_" + hex.EncodeToString(sum[:4])
+	}
+	return "shard_" + name + ".sql"
+}
+
+// partitionRecords splits records by their value of col, in order of value,
+// for the shard_VALUE.sql files of --partition-by.
+func partitionRecords(records []record, col string, table string) []tableRecords {
+	byVal := map[string][]record{}
+	for _, rec := range records {
+		byVal[rec[col]] = append(byVal[rec[col]], rec)
+	}
+	vals := maps.Keys(byVal)
+	sort.Slice(vals, func(i, j int) bool {
+		return compareValues(vals[i], vals[j]) < 0
+	})
+	partitions := []tableRecords{}
+	for _, v := range vals {
+		partitions = append(partitions, tableRecords{table, byVal[v], partitionFile(v)})
+	}
+	return partitions
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"strings"
+	"text/template"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// templateRecord is what a --template is executed with, once per record.
+type templateRecord struct {
+	// Table and PK are the table and pk column names
+	Table string
+	PK    string
+	// Fields are the record's raw values by sql column
+	Fields record
+
+	opts queryOpts
+}
+
+// Value renders the column's value as sql, with the same coercion, NULLs and
+// raw values as the built-in statements.
+func (rec templateRecord) Value(col string) (string, error) {
+	var val any
+	var err error
+	if col == rec.PK {
+		val, err = rec.opts.pkValue(rec.Fields[col])
+	} else {
+		val, err = rec.opts.value(col, rec.Fields[col])
+	}
+	if err != nil {
+		return "", err
+	}
+	return render(rec.opts.flavor, val)
+}
+
+// render renders v as sql in flavor, passing sqlbuilder.Raw values through.
+func render(flavor sqlbuilder.Flavor, v any) (string, error) {
+	args := &sqlbuilder.Args{}
+	sql, vals := args.CompileWithFlavor(args.Add(v), flavor)
+	return flavor.Interpolate(sql, vals)
+}
+
+// newTemplate parses a --template, with the functions
+//
+//	quote s   s as a string literal
+//	ident s   s as an identifier, quoted if it must be
+func newTemplate(text string, flavor sqlbuilder.Flavor) (*template.Template, error) {
+	return template.New("template").Funcs(template.FuncMap{
+		"quote": func(s string) (string, error) { return render(flavor, s) },
+		"ident": func(s string) string { return ident(flavor, s) },
+	}).Option("missingkey=error").Parse(text)
+}
+
+// templateQueries executes tmpl for each record. The output is written as
+// is, so the template supplies its own terminator.
+func templateQueries(tmpl *template.Template, records []record, table string, pk column, opts queryOpts) (queries []statement, err error) {
+	for _, rec := range records {
+		var b strings.Builder
+		fields := record{}
+		for _, col := range sqlColumns(rec) {
+			fields[col] = rec[col]
+		}
+		data := templateRecord{Table: table, PK: pk.SQL, Fields: fields, opts: opts}
+		if err := tmpl.Execute(&b, data); err != nil {
+			return queries, err
+		}
+		stmt := statement{SQL: b.String(), Fragment: true}
+		stmt.from([]record{rec}, pk)
+		queries = append(queries, stmt)
+	}
+	return queries, nil
+}
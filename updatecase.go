@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// updateCaseQueries builds, for each column, one UPDATE setting it with a
+// CASE over the pk for every record, in chunks of opts.batchSize records if
+// that's more than one. As with separate updates, the last record of a pk
+// wins. Raw assignments are set once per chunk, in the first statement.
+func updateCaseQueries(updates []record, table string, pk column, opts queryOpts) (queries []statement, err error) {
+	if len(updates) == 0 {
+		return queries, nil
+	}
+	raw := map[string]bool{}
+	for _, asg := range opts.rawAssigns {
+		raw[asg.Col] = true
+	}
+	cols := []string{}
+	for _, col := range sqlColumns(updates[0]) {
+		if col != pk.SQL && !raw[col] {
+			cols = append(cols, col)
+		}
+	}
+	sort.Strings(cols)
+	cols = orderColumns(cols, opts.columnOrder)
+
+	pkVals := []string{}
+	byPK := map[string]record{}
+	for _, upd := range updates {
+		if _, ok := byPK[upd[pk.SQL]]; !ok {
+			pkVals = append(pkVals, upd[pk.SQL])
+		}
+		byPK[upd[pk.SQL]] = upd
+	}
+
+	size := len(pkVals)
+	if opts.batchSize > 1 {
+		size = opts.batchSize
+	}
+	for _, chunk := range batches(pkVals, size) {
+		// the statements are built from the last record of each pk
+		recs := []record{}
+		for _, pkVal := range chunk {
+			recs = append(recs, byPK[pkVal])
+		}
+		for i, col := range cols {
+			stmt, err := opts.updateCaseQuery(chunk, byPK, col, i == 0, table, pk)
+			if err != nil {
+				return nil, err
+			}
+			stmt.from(recs, pk)
+			queries = append(queries, stmt)
+		}
+		if len(cols) == 0 && len(opts.rawAssigns) > 0 {
+			stmt, err := opts.updateCaseQuery(chunk, byPK, "", true, table, pk)
+			if err != nil {
+				return nil, err
+			}
+			stmt.from(recs, pk)
+			queries = append(queries, stmt)
+		}
+	}
+	return queries, nil
+}
+
+// updateCaseQuery sets col, if any, for the records of pkVals, along with
+// the raw assignments if withRaw.
+func (opts queryOpts) updateCaseQuery(pkVals []string, byPK map[string]record, col string, withRaw bool, table string, pk column) (stmt statement, err error) {
+	ub := opts.flavor.NewUpdateBuilder()
+	ub.Update(table)
+	assigns := []string{}
+	if col != "" {
+		var b strings.Builder
+		fmt.Fprintf(&b, "%s = CASE %s", sqlbuilder.Escape(ident(opts.flavor, col)), sqlbuilder.Escape(ident(opts.flavor, pk.SQL)))
+		for _, pkVal := range pkVals {
+			key, err := opts.pkValue(pkVal)
+			if err != nil {
+				return stmt, err
+			}
+			val, err := opts.value(col, byPK[pkVal][col])
+			if err != nil {
+				return stmt, err
+			}
+			fmt.Fprintf(&b, " WHEN %s THEN %s", ub.Var(key), ub.Var(val))
+		}
+		b.WriteString(" END")
+		assigns = append(assigns, b.String())
+	}
+	if withRaw {
+		for _, asg := range opts.rawAssigns {
+			assigns = append(assigns, ub.Assign(ident(opts.flavor, asg.Col), sqlbuilder.Raw(asg.Expr)))
+		}
+	}
+	ub.Set(assigns...)
+	pkCond, err := opts.pkCond(&ub.Cond, pk, pkVals)
+	if err != nil {
+		return stmt, err
+	}
+	ub.Where(pkCond)
+	return opts.statement(ub.Build())
+}
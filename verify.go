@@ -0,0 +1,42 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pingcap/parser"
+	"github.com/pingcap/parser/mysql"
+	_ "github.com/pingcap/parser/test_driver" // value expressions for the mysql parser
+	sqlparser "github.com/sunary/sqlize/sql-parser"
+)
+
+// verifySQL parses each statement with the parser for flavor, returning an
+// error listing the statements that don't parse. SQLite statements are
+// checked with the mysql parser in ANSI_QUOTES mode, so that it reads their
+// double quoted identifiers as sqlite does.
+func verifySQL(stmts []statement, flavor sqlbuilder.Flavor) error {
+	failures := []string{}
+	for i, stmt := range stmts {
+		if stmt.SQL == "" {
+			continue
+		}
+		if err := parseSQL(stmt.SQL, flavor); err != nil {
+			failures = append(failures, fmt.Sprintf("statement %v: %v\n%s", i, err, stmt.SQL))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("%v statements failed to parse:\n%s", len(failures), strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+func parseSQL(sql string, flavor sqlbuilder.Flavor) error {
+	if flavor == sqlbuilder.SQLite {
+		p := parser.New()
+		p.SetSQLMode(mysql.ModeANSIQuotes)
+		_, _, err := p.Parse(sql, "", "")
+		return err
+	}
+	return sqlparser.NewParser(flavor == sqlbuilder.PostgreSQL, false).Parser(sql)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/huandu/go-sqlbuilder"
+)
+
+func TestVerifySQLQuotedIdentifiers(t *testing.T) {
+	for _, flavor := range []sqlbuilder.Flavor{sqlbuilder.MySQL, sqlbuilder.PostgreSQL, sqlbuilder.SQLite} {
+		updates := []record{{"id": "1", "full name": "a", "2024": "5", "order": "2"}}
+		stmts, err := updateQueries(updates, "t", column{"id", "id"}, queryOpts{flavor: flavor})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := verifySQL(stmts, flavor); err != nil {
+			t.Errorf("%v: %v", flavor, err)
+		}
+	}
+}